@@ -0,0 +1,300 @@
+package mtcadmin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mtcrtc "github.com/kdnetwork/message-transfer-core/webrtc"
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
+)
+
+const (
+	TransportWebsocket = "ws"
+	TransportWebRTC    = "rtc"
+)
+
+var ErrForbidden = &mtcws.AuthError{Status: http.StatusForbidden, Message: "forbidden"}
+
+// Handler inspect and manage the connection pools, mount it with a prefix, e.g. `http.Handle("/admin/", http.StripPrefix("/admin", handler))`
+//
+//	GET  /conns                        list, filtered by `transport`, `conn_type`, `node_id` and `store.<key>=<value>`, paged by `offset` and `limit`
+//	GET  /conns/{transport}/{key}      a connection with its store and stats, `key` is `ConnKey()`
+//	POST /conns/{transport}/{key}/kick close with `reason` of the query, `kick` by default
+//	POST /conns/{transport}/{key}/send send the request body as a message
+type Handler struct {
+	WS  *mtcws.WsCoreCtx   // nil skips websocket connections
+	RTC *mtcrtc.RTCCoreCtx // nil skips webrtc connections
+
+	// checks every request, the status of the error is `mtcws.AuthErrorStatus(err)`. nil rejects all requests
+	Authorize func(r *http.Request) error
+
+	MaxMessageSize int64 // body limit of `send`, 1MB by default
+
+	mux     *http.ServeMux
+	muxOnce sync.Once
+}
+
+// ConnInfo a connection of either pool, `Store` and the stats are only set for a single connection
+type ConnInfo struct {
+	Transport   string            `json:"transport"`
+	Key         string            `json:"key"`
+	ID          string            `json:"id"`
+	SessionID   string            `json:"session_id,omitempty"`
+	ConnType    string            `json:"conn_type"`
+	Protocol    string            `json:"protocol"`
+	RemoteAddr  string            `json:"remote_addr"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	StoreKeys   []string          `json:"store_keys"`
+	Store       map[string]string `json:"store,omitempty"`
+
+	LastSeen       *time.Time `json:"last_seen,omitempty"`
+	RTTMs          *float64   `json:"rtt_ms,omitempty"`
+	SendQueueDepth *int       `json:"send_queue_depth,omitempty"`
+
+	store map[string]string
+}
+
+type ConnList struct {
+	Total int         `json:"total"`
+	Conns []*ConnInfo `json:"conns"`
+}
+
+// StaticToken `Authorize` accepting `Authorization: Bearer <token>`
+func StaticToken(token string) func(r *http.Request) error {
+	return func(r *http.Request) error {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || got == "" {
+			return mtcws.ErrMissingToken
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return ErrForbidden
+		}
+		return nil
+	}
+}
+
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler.Authorize == nil {
+		writeError(w, http.StatusForbidden, errors.New("admin: Authorize is not set"))
+		return
+	}
+	if err := handler.Authorize(r); err != nil {
+		writeError(w, mtcws.AuthErrorStatus(err), err)
+		return
+	}
+
+	handler.muxOnce.Do(func() {
+		handler.mux = http.NewServeMux()
+		handler.mux.HandleFunc("GET /conns", handler.list)
+		handler.mux.HandleFunc("GET /conns/{transport}/{key}", handler.get)
+		handler.mux.HandleFunc("POST /conns/{transport}/{key}/kick", handler.kick)
+		handler.mux.HandleFunc("POST /conns/{transport}/{key}/send", handler.send)
+	})
+	handler.mux.ServeHTTP(w, r)
+}
+
+func (handler *Handler) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	transport := query.Get("transport")
+	connType := query.Get("conn_type")
+	nodeID := query.Get("node_id")
+
+	storeFilter := make(map[string]string)
+	for key, values := range query {
+		if storeKey, ok := strings.CutPrefix(key, "store."); ok && len(values) > 0 {
+			storeFilter[storeKey] = values[0]
+		}
+	}
+
+	conns := []*ConnInfo{}
+	if handler.WS != nil && (transport == "" || transport == TransportWebsocket) {
+		for _, conn := range handler.WS.SelectConns(nil) {
+			conns = append(conns, wsConnInfo(conn))
+		}
+	}
+	if handler.RTC != nil && (transport == "" || transport == TransportWebRTC) {
+		for _, conn := range handler.RTC.SelectConns(nil) {
+			conns = append(conns, rtcConnInfo(conn))
+		}
+	}
+
+	conns = slices.DeleteFunc(conns, func(info *ConnInfo) bool {
+		if (connType != "" && info.ConnType != connType) || (nodeID != "" && info.ID != nodeID) {
+			return true
+		}
+		for key, value := range storeFilter {
+			if info.store[key] != value {
+				return true
+			}
+		}
+		return false
+	})
+	slices.SortStableFunc(conns, func(a, b *ConnInfo) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+
+	total := len(conns)
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset = min(max(offset, 0), total)
+	if limit <= 0 || offset+limit > total {
+		limit = total - offset
+	}
+
+	writeJSON(w, http.StatusOK, &ConnList{Total: total, Conns: conns[offset : offset+limit]})
+}
+
+func (handler *Handler) get(w http.ResponseWriter, r *http.Request) {
+	ws, rtc := handler.lookup(r)
+	switch {
+	case ws != nil:
+		info := wsConnInfo(ws)
+		info.Store = info.store
+		lastSeen, rtt := ws.Heartbeat.LastSeen(), float64(ws.Heartbeat.RTT().Microseconds())/1000
+		info.LastSeen, info.RTTMs = &lastSeen, &rtt
+		if ws.SendQueue != nil {
+			depth := ws.SendQueue.Depth()
+			info.SendQueueDepth = &depth
+		}
+		writeJSON(w, http.StatusOK, info)
+	case rtc != nil:
+		info := rtcConnInfo(rtc)
+		info.Store = info.store
+		lastSeen, rtt := rtc.Heartbeat.LastSeen(), float64(rtc.Heartbeat.RTT().Microseconds())/1000
+		info.LastSeen, info.RTTMs = &lastSeen, &rtt
+		writeJSON(w, http.StatusOK, info)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("connection not found"))
+	}
+}
+
+func (handler *Handler) kick(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "kick"
+	}
+
+	ws, rtc := handler.lookup(r)
+	switch {
+	case ws != nil:
+		ws.CloseWithReason(reason)
+	case rtc != nil:
+		rtc.CloseWithReason(reason)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("connection not found"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) send(w http.ResponseWriter, r *http.Request) {
+	ws, rtc := handler.lookup(r)
+	if ws == nil && rtc == nil {
+		writeError(w, http.StatusNotFound, errors.New("connection not found"))
+		return
+	}
+
+	maxSize := handler.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = 1 << 20
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		if maxErr := new(http.MaxBytesError); errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	if ws != nil {
+		err = ws.SendWebsocketMessage(data)
+	} else {
+		err = rtc.SendRTCMessage(data)
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup the connection of the path, at most one of them is not nil
+func (handler *Handler) lookup(r *http.Request) (*mtcws.WsConnContext, *mtcrtc.RTCConnContext) {
+	// `conn_type:node_id[:session_id]` of `ConnKey()`, the session id of websocket connections has no `:`
+	connType, nodeID, ok := strings.Cut(r.PathValue("key"), ":")
+	if !ok {
+		return nil, nil
+	}
+
+	switch r.PathValue("transport") {
+	case TransportWebsocket:
+		if index := strings.LastIndex(nodeID, ":"); handler.WS != nil && index >= 0 {
+			return handler.WS.GetConn(connType, nodeID[:index], nodeID[index+1:]), nil
+		}
+	case TransportWebRTC:
+		if handler.RTC != nil {
+			if conn := handler.RTC.GetConn(connType, nodeID); conn != nil {
+				return nil, conn
+			}
+		}
+	}
+	return nil, nil
+}
+
+func wsConnInfo(conn *mtcws.WsConnContext) *ConnInfo {
+	info := &ConnInfo{
+		Transport:   TransportWebsocket,
+		Key:         conn.ConnKey(),
+		ID:          conn.ID,
+		SessionID:   conn.SessionID,
+		ConnType:    conn.ConnType,
+		Protocol:    conn.Protocol,
+		ConnectedAt: conn.ConnectedAt,
+		store:       conn.CloneStore(),
+	}
+	if conn.Conn != nil {
+		info.RemoteAddr = conn.Conn.RemoteAddr().String()
+	}
+	info.StoreKeys = slices.Sorted(maps.Keys(info.store))
+
+	return info
+}
+
+func rtcConnInfo(conn *mtcrtc.RTCConnContext) *ConnInfo {
+	info := &ConnInfo{
+		Transport:   TransportWebRTC,
+		Key:         conn.ConnKey(),
+		ID:          conn.ID,
+		ConnType:    conn.ConnType,
+		Protocol:    conn.Protocol,
+		RemoteAddr:  conn.RemoteAddr(),
+		ConnectedAt: conn.ConnectedAt,
+		store:       conn.CloneStore(),
+	}
+	info.StoreKeys = slices.Sorted(maps.Keys(info.store))
+
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
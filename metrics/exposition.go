@@ -0,0 +1,122 @@
+package mtcmetrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func writeLabels(w *bufio.Writer, names, values []string, extraName, extraValue string) {
+	if len(names) == 0 && extraName == "" {
+		return
+	}
+
+	w.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(name + `="` + labelEscaper.Replace(values[i]) + `"`)
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(extraName + `="` + extraValue + `"`)
+	}
+	w.WriteByte('}')
+}
+
+// WriteText the text exposition format (version 0.0.4), families and series are sorted
+func (registry *MemoryRegistry) WriteText(out io.Writer) error {
+	registry.mu.RLock()
+	families := make([]*family, 0, len(registry.families))
+	for _, f := range registry.families {
+		families = append(families, f)
+	}
+	registry.mu.RUnlock()
+
+	slices.SortFunc(families, func(a, b *family) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		f.write(w)
+	}
+
+	return w.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.WriteString("# HELP " + f.name + " " + helpEscaper.Replace(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+
+		if f.kind != kindHistogram {
+			w.WriteString(f.name)
+			writeLabels(w, f.labels, s.labelValues, "", "")
+			w.WriteString(" " + formatFloat(s.value) + "\n")
+			continue
+		}
+
+		var cumulative uint64
+		for i, upperBound := range f.buckets {
+			cumulative += s.counts[i]
+			w.WriteString(f.name + "_bucket")
+			writeLabels(w, f.labels, s.labelValues, "le", formatFloat(upperBound))
+			w.WriteString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(f.name + "_bucket")
+		writeLabels(w, f.labels, s.labelValues, "le", "+Inf")
+		w.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+
+		w.WriteString(f.name + "_sum")
+		writeLabels(w, f.labels, s.labelValues, "", "")
+		w.WriteString(" " + formatFloat(s.sum) + "\n")
+
+		w.WriteString(f.name + "_count")
+		writeLabels(w, f.labels, s.labelValues, "", "")
+		w.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+// ServeHTTP e.g. `http.Handle("/metrics", registry)`
+func (registry *MemoryRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := registry.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
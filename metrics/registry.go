@@ -0,0 +1,179 @@
+package mtcmetrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry set on `WsCoreCtx`, `RTCCoreCtx` or `MocaJsonRPCCtx` to record their metrics, registering a name twice returns the same metric
+// (`MemoryRegistry` panics if the type or labels differ).
+// `MemoryRegistry` is built in, adapt other clients (e.g. prometheus/client_golang) by implementing it
+type Registry interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// label values are in the order of the registered labels, observations with a wrong number of values are ignored
+
+type Counter interface {
+	Add(value float64, labelValues ...string)
+}
+
+type Gauge interface {
+	Add(value float64, labelValues ...string)
+	Set(value float64, labelValues ...string)
+}
+
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+var (
+	// DefaultBuckets seconds of latencies
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// LifetimeBuckets seconds of connection lifetimes, up to a day
+	LifetimeBuckets = []float64{1, 10, 60, 300, 1800, 3600, 4 * 3600, 12 * 3600, 24 * 3600}
+)
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// MemoryRegistry keeps metrics in memory and serves them in the prometheus text format
+type MemoryRegistry struct {
+	families map[string]*family
+
+	mu sync.RWMutex
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		families: make(map[string]*family),
+	}
+}
+
+// DefaultRegistry shared by the cores if they set it as `Metrics`
+var DefaultRegistry = NewMemoryRegistry()
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	series map[string]*series
+
+	mu sync.Mutex
+}
+
+type series struct {
+	labelValues []string
+
+	value  float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (registry *MemoryRegistry) register(name, help, kind string, buckets []float64, labels []string) *family {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if f, ok := registry.families[name]; ok {
+		if f.kind != kind || !slices.Equal(f.labels, labels) {
+			panic("mtcmetrics: " + name + " is registered with another type or labels")
+		}
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  slices.Clone(labels),
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  make(map[string]*series),
+	}
+	registry.families[name] = f
+
+	return f
+}
+
+func (registry *MemoryRegistry) Counter(name, help string, labels ...string) Counter {
+	return registry.register(name, help, kindCounter, nil, labels)
+}
+
+func (registry *MemoryRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return registry.register(name, help, kindGauge, nil, labels)
+}
+
+// Histogram nil buckets uses `DefaultBuckets`
+func (registry *MemoryRegistry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return registry.register(name, help, kindHistogram, buckets, labels)
+}
+
+// get the series of the label values, the lock of the family must be held
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		return nil
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// Add counters ignore negative values
+func (f *family) Add(value float64, labelValues ...string) {
+	if f.kind == kindCounter && value < 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s := f.get(labelValues); s != nil {
+		s.value += value
+	}
+}
+
+func (f *family) Set(value float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s := f.get(labelValues); s != nil {
+		s.value = value
+	}
+}
+
+func (f *family) Observe(value float64, labelValues ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labelValues)
+	if s == nil {
+		return
+	}
+
+	if i, _ := slices.BinarySearch(f.buckets, value); i < len(f.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+}
@@ -0,0 +1,89 @@
+package mtcmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMemoryRegistryText(t *testing.T) {
+	registry := NewMemoryRegistry()
+
+	sent := registry.Counter("mtc_sent_total", "Messages sent.\nBy type.", "conn_type")
+	sent.Add(2, "user")
+	sent.Add(1, `a"b\c`)
+	sent.Add(-1, "user")       // counters never decrease
+	sent.Add(1, "user", "any") // wrong number of label values
+
+	live := registry.Gauge("mtc_live", "Live connections.")
+	live.Add(3)
+	live.Add(-1)
+
+	state := registry.Gauge("mtc_state", "Last state.", "conn_type")
+	state.Set(5, "user")
+	state.Set(0.5, "user")
+
+	latency := registry.Histogram("mtc_latency_seconds", "Latency.", []float64{1, 0.1}, "method")
+	for _, value := range []float64{0.05, 0.1, 0.5, 2} {
+		latency.Observe(value, "echo")
+	}
+
+	// registered again, the same metric
+	registry.Counter("mtc_sent_total", "Messages sent.", "conn_type").Add(1, "user")
+
+	want := `# HELP mtc_latency_seconds Latency.
+# TYPE mtc_latency_seconds histogram
+mtc_latency_seconds_bucket{method="echo",le="0.1"} 2
+mtc_latency_seconds_bucket{method="echo",le="1"} 3
+mtc_latency_seconds_bucket{method="echo",le="+Inf"} 4
+mtc_latency_seconds_sum{method="echo"} 2.65
+mtc_latency_seconds_count{method="echo"} 4
+# HELP mtc_live Live connections.
+# TYPE mtc_live gauge
+mtc_live 2
+# HELP mtc_sent_total Messages sent.\nBy type.
+# TYPE mtc_sent_total counter
+mtc_sent_total{conn_type="a\"b\\c"} 1
+mtc_sent_total{conn_type="user"} 3
+# HELP mtc_state Last state.
+# TYPE mtc_state gauge
+mtc_state{conn_type="user"} 0.5
+`
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("exposition\n%s\nwant\n%s", out.String(), want)
+	}
+
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", contentType)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("status %d body\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestMemoryRegistryConflict(t *testing.T) {
+	registry := NewMemoryRegistry()
+	registry.Counter("mtc_total", "Total.", "conn_type")
+
+	for name, register := range map[string]func(){
+		"type":   func() { registry.Gauge("mtc_total", "Total.", "conn_type") },
+		"labels": func() { registry.Counter("mtc_total", "Total.", "reason") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("registered with another " + name)
+				}
+			}()
+			register()
+		})
+	}
+}
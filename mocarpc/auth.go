@@ -0,0 +1,53 @@
+package mocarpc
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+type MocaRPCMethodMeta struct {
+	Public    bool     // skip the authorizer
+	Scopes    []string // all required
+	ConnTypes []string // allowed `conn_type`, empty allows all
+}
+
+// MocaRPCAuthorizer returns `Unauthorized` for unknown callers and `Forbidden` for missing permissions
+type MocaRPCAuthorizer func(session *MocaRPCSession, method string, meta *MocaRPCMethodMeta) (int, error)
+
+// Authorize check the caller of `in` against the meta of its method
+func (corectx *MocaJsonRPCCtx) Authorize(in *MocaJsonRPCBase) (int, error) {
+	meta := corectx.MethodsMeta[in.Method]
+	if meta == nil || meta.Public {
+		return 0, nil
+	}
+
+	authorizer := corectx.Authorizer
+	if authorizer == nil {
+		authorizer = DefaultAuthorizer
+	}
+
+	return authorizer(in.Session, in.Method, meta)
+}
+
+// DefaultAuthorizer the caller is identified by `Store["node_id"]`, scopes are read from `Store["scopes"]` (separated by spaces or commas)
+func DefaultAuthorizer(session *MocaRPCSession, method string, meta *MocaRPCMethodMeta) (int, error) {
+	if session == nil || session.Store["node_id"] == "" {
+		return Unauthorized, errors.New("mockrpc: unauthenticated caller")
+	}
+
+	if len(meta.ConnTypes) > 0 && !slices.Contains(meta.ConnTypes, session.Store["conn_type"]) {
+		return Forbidden, errors.New("mockrpc: conn_type not allowed")
+	}
+
+	granted := strings.FieldsFunc(session.Store["scopes"], func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	for _, scope := range meta.Scopes {
+		if !slices.Contains(granted, scope) {
+			return Forbidden, errors.New("mockrpc: missing scope " + scope)
+		}
+	}
+
+	return 0, nil
+}
@@ -5,53 +5,134 @@ import (
 	"encoding/json"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jellydator/ttlcache/v3"
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
 )
 
 type MocaJsonRPCCtx struct {
-	Methods map[string]MocaRPCMethod
+	Methods     map[string]MocaRPCMethod
+	MethodsMeta map[string]*MocaRPCMethodMeta
+
+	// nil uses `DefaultAuthorizer`, only methods registered with a non-public meta are checked
+	Authorizer MocaRPCAuthorizer
 
 	SyncMap *ttlcache.Cache[string, *SyncMocaRPCType]
 
+	// rate limit, change with `SetRateLimit()`
+	RateLimits       map[string][]*MocaRPCRateLimit
+	RateLimitBuckets *ttlcache.Cache[string, *MocaRPCTokenBucket]
+	rateLimitsMu     sync.RWMutex
+
+	// session id -> keys of its buckets
+	rateLimitSessions   map[string]map[string]struct{}
+	rateLimitSessionsMu sync.Mutex
+
 	ReadMessageChan chan *ReadMessageChanStruct
 	WriteMessage    func(string, int, []byte) error
 
+	// peer only, the connection of this endpoint
+	Session *MocaRPCSession
+	Parent  *MocaJsonRPCCtx
+
 	GlobalContext       context.Context
 	GlobalContextCancel context.CancelFunc
 
 	// settings
 	// IgnoreInvalidRequest bool
 	UseJsonRPC2 bool
+	CallTimeout time.Duration // timeout of `Call`, extended by each progress update
+	IDGenerator func() any    // ids of `Call` without id, string or number, `NewIntIDGenerator()` by default
+
+	// nil disables metrics
+	Metrics     mtcmetrics.Registry
+	metricsOnce sync.Once
+	metricsVecs *rpcMetrics
+
+	// spans of `Call` and handlers, nil disables tracing
+	Tracer mtctrace.Tracer
+
+	// nil uses `slog.Default()`
+	Logger  *slog.Logger
+	log     *slog.Logger
+	logOnce sync.Once
 }
 
 type ReadMessageChanStruct struct {
 	ID      string
 	Message []byte
+	Session *MocaRPCSession
+}
+
+// MocaRPCSession the connection a message came from, `ID` should be unique per connection (e.g. `conn_type:node_id`)
+type MocaRPCSession struct {
+	ID    string
+	Store map[string]string
 }
 
 func (corectx *MocaJsonRPCCtx) ReadMessage(message []byte) string {
+	return corectx.ReadSessionMessage(corectx.Session, message)
+}
+
+func (corectx *MocaJsonRPCCtx) ReadSessionMessage(session *MocaRPCSession, message []byte) string {
 	id := uuid.NewString()
-	corectx.ReadMessageChan <- &ReadMessageChanStruct{
+	select {
+	case corectx.ReadMessageChan <- &ReadMessageChanStruct{
 		Message: message,
 		ID:      id,
+		Session: session,
+	}:
+	case <-corectx.GlobalContext.Done():
 	}
 
 	return id
 }
 
+// ReleaseSession drop all states of a closed connection, call it in `OnDisConnected`
+func (corectx *MocaJsonRPCCtx) ReleaseSession(sessionID string) {
+	corectx.releaseRateLimitBuckets(sessionID)
+}
+
 // TODO ttl
 func InitMocaJsonRPCCtx(ctx context.Context) *MocaJsonRPCCtx {
-	ctx, cancel := context.WithCancel(context.Background())
+	// the lifetime is owned by `GlobalContextCancel`, ctx is not inherited
+	corectx := initMocaJsonRPCCtx(context.Background())
+	corectx.Methods = make(map[string]MocaRPCMethod)
+	corectx.MethodsMeta = make(map[string]*MocaRPCMethodMeta)
+	corectx.RateLimits = make(map[string][]*MocaRPCRateLimit)
+	corectx.RateLimitBuckets = ttlcache.New(
+		ttlcache.WithTTL[string, *MocaRPCTokenBucket](time.Minute * 10),
+	)
+	corectx.rateLimitSessions = make(map[string]map[string]struct{})
+	corectx.RateLimitBuckets.OnEviction(func(ctx context.Context, reason ttlcache.EvictionReason, item *ttlcache.Item[string, *MocaRPCTokenBucket]) {
+		corectx.unindexRateLimitBucket(item.Value().session, item.Key())
+	})
+
+	corectx.RegisterMethod(ProgressMethod, corectx.onProgress)
+
+	go corectx.RateLimitBuckets.Start()
+	go func() {
+		<-corectx.GlobalContext.Done()
+		corectx.RateLimitBuckets.Stop()
+	}()
+
+	return corectx
+}
+
+// initMocaJsonRPCCtx peers pass the context of their parent
+func initMocaJsonRPCCtx(ctx context.Context) *MocaJsonRPCCtx {
+	ctx, cancel := context.WithCancel(ctx)
 	corectx := &MocaJsonRPCCtx{
-		Methods: make(map[string]MocaRPCMethod),
 		SyncMap: ttlcache.New(
 			ttlcache.WithDisableTouchOnHit[string, *SyncMocaRPCType](),
 			ttlcache.WithTTL[string, *SyncMocaRPCType](time.Second*11),
 		),
 		ReadMessageChan: make(chan *ReadMessageChanStruct, 2000),
+		IDGenerator:     NewIntIDGenerator(),
 
 		GlobalContext:       ctx,
 		GlobalContextCancel: cancel,
@@ -63,59 +144,77 @@ func InitMocaJsonRPCCtx(ctx context.Context) *MocaJsonRPCCtx {
 	go func() {
 		<-ctx.Done()
 		corectx.SyncMap.Stop()
-		close(corectx.ReadMessageChan)
 	}()
 
 	return corectx
 }
 
 func (corectx *MocaJsonRPCCtx) OnMessage() {
-	for messageStruct := range corectx.ReadMessageChan {
+	for {
+		var messageStruct *ReadMessageChanStruct
+		select {
+		case messageStruct = <-corectx.ReadMessageChan:
+		case <-corectx.GlobalContext.Done():
+			return
+		}
+
 		message := strings.TrimSpace(string(messageStruct.Message))
+		// built on the first record, most messages log nothing
+		logger := func() *slog.Logger {
+			return corectx.sessionLogger(messageStruct.Session).With("read_id", messageStruct.ID)
+		}
 		// parse
-		if len(message) <= 2 || !strings.HasPrefix(message, "{") || !strings.HasPrefix(message, "[") {
-			slog.Debug("mocarpc", "id", messageStruct.ID, "original_message", message)
+		if len(message) < 2 || (!strings.HasPrefix(message, "{") && !strings.HasPrefix(message, "[")) {
+			logger().Debug("parse_failed", "message", message)
 
 			res := corectx.NullIDErrorBuilder(messageStruct.ID, ParseError)
 			if corectx.WriteMessage != nil {
 				if err := corectx.WriteMessage(messageStruct.ID, ParseError, res); err != nil {
-					slog.Error("mocarpc", "write error:", err)
+					logger().Error("write_failed", "error", err)
 				}
 			}
+			continue
 		}
 
 		// TODO prevent loop reading
 		if IsJSONArrayFast(message) {
 			parsedData := corectx.ParseBatch(messageStruct.Message)
 			if len(parsedData) == 1 && parsedData[0].ErrorCode != 0 {
-				slog.Debug("mocarpc", "id", messageStruct.ID, "original_message", message, "parsed_message", parsedData)
+				logger().Debug("parse_failed", "message", message)
 
 				res := corectx.NullIDErrorBuilder(messageStruct.ID, ParseError)
 				if corectx.WriteMessage != nil {
 					if err := corectx.WriteMessage(messageStruct.ID, ParseError, res); err != nil {
-						slog.Error("mocarpc", "write error:", err)
+						logger().Error("write_failed", "error", err)
 					}
 				}
 				continue
 			} else if len(parsedData) == 0 {
-				slog.Debug("mocarpc", "id", messageStruct.ID, "original_message", message, "parsed_message", parsedData)
+				logger().Debug("empty_batch", "message", message)
 
 				res := corectx.NullIDErrorBuilder(messageStruct.ID, InvalidRequest)
 				if corectx.WriteMessage != nil {
 					if err := corectx.WriteMessage(messageStruct.ID, InvalidRequest, res); err != nil {
-						slog.Error("mocarpc", "write error:", err)
+						logger().Error("write_failed", "error", err)
 					}
 				}
 				continue
 			}
 
 			if parsedData[0].RequestType == MocaRPCMessageTypeRequest {
+				for _, reqStruct := range parsedData {
+					if reqStruct.Message != nil {
+						reqStruct.Message.Session = messageStruct.Session
+						reqStruct.Message.ReadID = messageStruct.ID
+					}
+				}
+
 				go func() {
 					res := []*MocaJsonRPCBase{}
 
 					for _, reqStruct := range parsedData {
 						if reqStruct.ErrorCode != 0 {
-							slog.Error("mocarpc", "error:", reqStruct.Error)
+							logger().Error("invalid_request", "error", reqStruct.Error)
 							res = append(res, corectx.RsponseBuilder(reqStruct.Message.ID, &MocaJsonRPCError{
 								Code:    reqStruct.ErrorCode,
 								Message: reqStruct.Error.Error(),
@@ -125,7 +224,7 @@ func (corectx *MocaJsonRPCCtx) OnMessage() {
 							r, _, err := corectx.MocaRPCMethodFunc(reqStruct.Message.MocaJsonRPCBase)
 
 							if err != nil {
-								slog.Error("mocarpc", "err:", err)
+								logger().Error("handler_failed", "method", reqStruct.Message.Method, "error", err)
 							}
 
 							if r == nil {
@@ -140,17 +239,17 @@ func (corectx *MocaJsonRPCCtx) OnMessage() {
 					}
 					responseBytes, err := json.Marshal(res)
 					if err != nil {
-						slog.Error("mocarpc", "marshal error:", err)
+						logger().Error("marshal_failed", "error", err)
 						return
 					}
 					if corectx.WriteMessage != nil {
 						if err := corectx.WriteMessage(messageStruct.ID, 0, responseBytes); err != nil {
-							slog.Error("mocarpc", "write error:", err)
+							logger().Error("write_failed", "error", err)
 						}
 					}
 				}()
-			} else {
-				if syncCall := corectx.SyncMap.Get(string(parsedData[0].Message.ID)); syncCall != nil {
+			} else if parsedData[0].RequestType == MocaRPCMessageTypeResponse {
+				if syncCall := corectx.SyncMap.Get(NormalizeID(parsedData[0].Message.ID)); syncCall != nil {
 					batchRes := []*MocaJsonRPCResponse{}
 					for _, pd := range parsedData {
 						batchRes = append(batchRes, pd.Message)
@@ -164,15 +263,25 @@ func (corectx *MocaJsonRPCCtx) OnMessage() {
 
 			if parsedData.RequestType == MocaRPCMessageTypeRequest {
 				if parsedData.Error != nil {
-					slog.Error("mocarpc", "error:", parsedData.Error)
-					return
+					logger().Error("invalid_request", "error", parsedData.Error)
+					continue
+				}
+				parsedData.Message.Session = messageStruct.Session
+				parsedData.Message.ReadID = messageStruct.ID
+
+				// in the read loop, a progress update is never passed by the response of its call
+				if parsedData.Message.Method == ProgressMethod && parsedData.Message.ID == nil {
+					if _, _, err := corectx.onProgress(parsedData.Message.MocaJsonRPCBase); err != nil {
+						logger().Debug("progress_invalid", "error", err)
+					}
+					continue
 				}
 
 				go func() {
 					r, code, err := corectx.MocaRPCMethodFunc(parsedData.Message.MocaJsonRPCBase)
 
 					if err != nil {
-						slog.Error("mocarpc", "err:", err)
+						logger().Error("handler_failed", "method", parsedData.Message.Method, "error", err)
 					}
 
 					// restrn a nil will not response
@@ -182,20 +291,43 @@ func (corectx *MocaJsonRPCCtx) OnMessage() {
 
 					responseBytes, err := json.Marshal(r)
 					if err != nil {
-						slog.Error("mocarpc", "marshal error:", err)
+						logger().Error("marshal_failed", "error", err)
 						return
 					}
 					if corectx.WriteMessage != nil {
 						if err := corectx.WriteMessage(messageStruct.ID, code, responseBytes); err != nil {
-							slog.Error("mocarpc", "write error:", err)
+							logger().Error("write_failed", "error", err)
 						}
 					}
 				}()
-			} else {
-				if syncCall := corectx.SyncMap.Get(string(parsedData.Message.ID)); syncCall != nil {
+			} else if parsedData.RequestType == MocaRPCMessageTypeResponse {
+				if syncCall := corectx.SyncMap.Get(NormalizeID(parsedData.Message.ID)); syncCall != nil {
 					syncCall.Value().CallbackChan <- parsedData.Message
 				}
 			}
 		}
 	}
 }
+
+// logger `Logger` or `slog.Default()`, with `module=mocarpc` and the `session_id` of a peer
+func (corectx *MocaJsonRPCCtx) logger() *slog.Logger {
+	corectx.logOnce.Do(func() {
+		logger := corectx.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		corectx.log = logger.With("module", "mocarpc")
+		if corectx.Session != nil {
+			corectx.log = corectx.log.With("session_id", corectx.Session.ID)
+		}
+	})
+	return corectx.log
+}
+
+// sessionLogger the logger of a message from the session, peers log their own session
+func (corectx *MocaJsonRPCCtx) sessionLogger(session *MocaRPCSession) *slog.Logger {
+	if session == nil || corectx.Session != nil {
+		return corectx.logger()
+	}
+	return corectx.logger().With("session_id", session.ID)
+}
@@ -6,6 +6,11 @@ const (
 	MethodNotFound = -32601
 	InvalidParams  = -32602
 	InternalError  = -32603
+
+	// server errors (-32000 to -32099)
+	Unauthorized = -32001
+	Forbidden    = -32003
+	RateLimited  = -32029
 )
 
 var ErrorsMap = map[int]string{
@@ -14,4 +19,7 @@ var ErrorsMap = map[int]string{
 	MethodNotFound: "Method not found",
 	InvalidParams:  "Invalid params",
 	InternalError:  "Internal error",
+	Unauthorized:   "Unauthorized",
+	Forbidden:      "Forbidden",
+	RateLimited:    "Rate limited",
 }
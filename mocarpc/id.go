@@ -0,0 +1,79 @@
+package mocarpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// NewIntIDGenerator monotonic integer ids starting from 1
+func NewIntIDGenerator() func() any {
+	var counter atomic.Uint64
+	return func() any {
+		return counter.Add(1)
+	}
+}
+
+func UUIDGenerator() any {
+	return uuid.NewString()
+}
+
+// NextID a new request id from `IDGenerator`
+func (corectx *MocaJsonRPCCtx) NextID() json.RawMessage {
+	if corectx.IDGenerator == nil {
+		return EncodeID(UUIDGenerator())
+	}
+
+	return EncodeID(corectx.IDGenerator())
+}
+
+// EncodeID encode a string or number id, nil and "" returns nil (notification)
+func EncodeID(id any) json.RawMessage {
+	switch v := id.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+	case json.RawMessage:
+		if len(v) == 0 {
+			return nil
+		}
+		return json.RawMessage(NormalizeID(v))
+	}
+
+	rawJson, err := json.Marshal(id)
+	if err != nil {
+		return nil
+	}
+
+	return rawJson
+}
+
+// NormalizeID the key to match a response to its request, `1`, ` 1 ` and `"a"`, `"a"` are the same id
+func NormalizeID(id json.RawMessage) string {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(id))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return string(id)
+	}
+
+	switch v := value.(type) {
+	case string:
+		rawJson, _ := json.Marshal(v)
+		return string(rawJson)
+	case json.Number:
+		return v.String()
+	}
+
+	compacted := new(bytes.Buffer)
+	if err := json.Compact(compacted, id); err != nil {
+		return string(id)
+	}
+
+	return compacted.String()
+}
@@ -1,11 +1,58 @@
 package mocarpc
 
-import "errors"
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+)
 
 type MocaRPCMethod func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error)
 
+// MocaRPCMethodFunc the handler span `mocarpc.handle` is a child of the caller span in `in.TraceParent`
 func (corectx *MocaJsonRPCCtx) MocaRPCMethodFunc(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+	ctx := mtctrace.Extract(corectx.GlobalContext, in.TraceParent)
+	ctx, span := mtctrace.Start(corectx.Tracer, ctx, "mocarpc.handle", mtctrace.String("rpc.method", in.Method))
+	defer span.End()
+	in.Ctx = ctx
+
+	start := time.Now()
+	res, code, err := corectx.callMethod(in)
+	corectx.metrics().handledRequest(in.Method, code, time.Since(start))
+
+	span.SetAttr("rpc.code", strconv.Itoa(code))
+	span.RecordError(err)
+
+	return res, code, err
+}
+
+func (corectx *MocaJsonRPCCtx) callMethod(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
 	if handler, exists := corectx.Methods[in.Method]; exists {
+		if code, err := corectx.Authorize(in); err != nil {
+			if ErrorsMap[code] == "" {
+				code = Unauthorized
+			}
+			return corectx.RsponseBuilder(in.ID, &MocaJsonRPCError{
+				Code:    code,
+				Message: ErrorsMap[code],
+				Data: map[string]any{
+					"method": in.Method,
+				},
+			}), code, err
+		}
+
+		if retryAfter, limited := corectx.TakeRateLimit(in); limited {
+			return corectx.RsponseBuilder(in.ID, &MocaJsonRPCError{
+				Code:    RateLimited,
+				Message: ErrorsMap[RateLimited],
+				Data: map[string]any{
+					"retry_after": math.Ceil(retryAfter.Seconds()*1000) / 1000,
+				},
+			}), RateLimited, errors.New("rate limited")
+		}
+
 		res, errorCode, err := handler(in)
 
 		if err != nil {
@@ -28,3 +75,9 @@ func (corectx *MocaJsonRPCCtx) MocaRPCMethodFunc(in *MocaJsonRPCBase) (*MocaJson
 func (corectx *MocaJsonRPCCtx) RegisterMethod(method string, handler MocaRPCMethod) {
 	corectx.Methods[method] = handler
 }
+
+// RegisterMethodWithMeta register a method with access requirements, checked by `Authorizer` before the handler is called
+func (corectx *MocaJsonRPCCtx) RegisterMethodWithMeta(method string, handler MocaRPCMethod, meta *MocaRPCMethodMeta) {
+	corectx.Methods[method] = handler
+	corectx.MethodsMeta[method] = meta
+}
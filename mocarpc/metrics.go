@@ -0,0 +1,75 @@
+package mocarpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+)
+
+type rpcMetrics struct {
+	handled         mtcmetrics.Counter
+	handlerDuration mtcmetrics.Histogram
+	calls           mtcmetrics.Counter
+	callDuration    mtcmetrics.Histogram
+}
+
+// metrics nil if `Metrics` is not set, created on the first use
+func (corectx *MocaJsonRPCCtx) metrics() *rpcMetrics {
+	if corectx.Metrics == nil {
+		return nil
+	}
+
+	corectx.metricsOnce.Do(func() {
+		corectx.metricsVecs = &rpcMetrics{
+			handled:         corectx.Metrics.Counter("mocarpc_handled_total", "Handled requests by method and error code, 0 is success.", "method", "code"),
+			handlerDuration: corectx.Metrics.Histogram("mocarpc_handler_duration_seconds", "Latency of method handlers.", nil, "method"),
+			calls:           corectx.Metrics.Counter("mocarpc_calls_total", "Outgoing calls by method and error code, 0 is success.", "method", "code"),
+			callDuration:    corectx.Metrics.Histogram("mocarpc_call_duration_seconds", "Latency of outgoing calls until the response.", nil, "method"),
+		}
+	})
+
+	return corectx.metricsVecs
+}
+
+func (m *rpcMetrics) handledRequest(method string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	// not registered methods come from the remote, keep them out of the labels
+	if code == MethodNotFound {
+		method = "unknown"
+	}
+
+	m.handled.Add(1, method, strconv.Itoa(code))
+	m.handlerDuration.Observe(duration.Seconds(), method)
+}
+
+// callCode the error code of the response, or `timeout`, `canceled` and `error` without a response
+func callCode(response *MocaJsonRPCResponse, err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case err != nil:
+		return "error"
+	case response != nil && response.MocaJsonRPCBase != nil && response.Error != nil:
+		return strconv.Itoa(response.Error.Code)
+	}
+	return "0"
+}
+
+// calledRemote `code` is the error code of the response, or `timeout`, `canceled` and `error` without a response
+func (m *rpcMetrics) calledRemote(method string, response *MocaJsonRPCResponse, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	code := callCode(response, err)
+	m.calls.Add(1, method, code)
+	m.callDuration.Observe(duration.Seconds(), method)
+}
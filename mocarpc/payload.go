@@ -1,6 +1,7 @@
 package mocarpc
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -15,6 +16,16 @@ type MocaJsonRPCBase struct {
 	// Response
 	Result any               `json:"result,omitempty"`
 	Error  *MocaJsonRPCError `json:"error,omitempty"`
+
+	// the connection of an incoming request, nil for local calls
+	Session *MocaRPCSession `json:"-"`
+	// the id returned by `ReadMessage`, passed back to `WriteMessage`
+	ReadID string `json:"-"`
+
+	// W3C trace context of a request, set by `Call` if the caller is traced
+	TraceParent string `json:"traceparent,omitempty"`
+	// ctx of the handler span, pass it to `Call` to continue the trace, nil for local calls
+	Ctx context.Context `json:"-"`
 }
 
 type MocaJsonRPCResponse struct {
@@ -36,13 +47,11 @@ type MocaJsonRPCError struct {
 	Data    any    `json:"data,omitempty"`
 }
 
-func (corectx *MocaJsonRPCCtx) RequestBuilder(id, method string, params ...any) *MocaJsonRPCBase {
+// RequestBuilder `id` is a string or number, nil or "" builds a notification
+func (corectx *MocaJsonRPCCtx) RequestBuilder(id any, method string, params ...any) *MocaJsonRPCBase {
 	req := &MocaJsonRPCBase{
 		Method: method,
-	}
-
-	if id != "" {
-		req.ID = json.RawMessage("\"" + id + "\"")
+		ID:     EncodeID(id),
 	}
 
 	if corectx.UseJsonRPC2 {
@@ -77,10 +86,10 @@ func (corectx *MocaJsonRPCCtx) RsponseBuilder(id json.RawMessage, _error *MocaJs
 	if len(results) == 1 {
 		// TODO err...
 		rawJson, _ := json.Marshal(results[0])
-		res.Result = rawJson
+		res.Result = json.RawMessage(rawJson)
 	} else if len(results) > 1 {
 		rawJson, _ := json.Marshal(results)
-		res.Result = rawJson
+		res.Result = json.RawMessage(rawJson)
 	}
 
 	return res
@@ -0,0 +1,59 @@
+package mocarpc
+
+import (
+	"maps"
+)
+
+// NewPeer creates the endpoint of one connection, it serves `Methods` and `Call`s the remote over `write`.
+//
+// Methods are copied from `corectx` (register connection-only methods on the peer), rate limits and settings are shared.
+//
+// Incoming requests are dispatched to `Methods` and never touch the pending calls, and incoming responses only match calls issued by this peer,
+// so both sides can use the same ids at the same time.
+func (corectx *MocaJsonRPCCtx) NewPeer(session *MocaRPCSession, write func(message []byte) error) *MocaJsonRPCCtx {
+	peer := initMocaJsonRPCCtx(corectx.GlobalContext)
+	peer.Parent = corectx
+	peer.Session = session
+	peer.Methods = maps.Clone(corectx.Methods)
+	peer.MethodsMeta = maps.Clone(corectx.MethodsMeta)
+	peer.Authorizer = corectx.Authorizer
+	peer.RateLimits = corectx.RateLimits
+	peer.RateLimitBuckets = corectx.RateLimitBuckets
+	peer.UseJsonRPC2 = corectx.UseJsonRPC2
+	peer.CallTimeout = corectx.CallTimeout
+	peer.IDGenerator = corectx.IDGenerator // shared, ids stay unique across the peers
+	peer.Metrics = corectx.Metrics
+	peer.Tracer = corectx.Tracer
+	peer.Logger = corectx.Logger
+
+	peer.RegisterMethod(ProgressMethod, peer.onProgress)
+
+	if write != nil {
+		peer.WriteMessage = func(_ string, _ int, message []byte) error {
+			return write(message)
+		}
+	}
+
+	return peer
+}
+
+// Close stop the peer, pending calls return `context.Canceled`
+func (corectx *MocaJsonRPCCtx) Close() {
+	corectx.GlobalContextCancel()
+
+	if corectx.Parent != nil && corectx.Session != nil {
+		corectx.Parent.ReleaseSession(corectx.Session.ID)
+	}
+}
+
+// Pipe connects two endpoints in memory, messages written by one side are read by the other
+func Pipe(a, b *MocaJsonRPCCtx) {
+	a.WriteMessage = func(_ string, _ int, message []byte) error {
+		b.ReadMessage(message)
+		return b.GlobalContext.Err()
+	}
+	b.WriteMessage = func(_ string, _ int, message []byte) error {
+		a.ReadMessage(message)
+		return a.GlobalContext.Err()
+	}
+}
@@ -0,0 +1,128 @@
+package mocarpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type peerEchoParams struct {
+	From string `json:"from"`
+	Seq  int    `json:"seq"`
+}
+
+type peerEchoResult struct {
+	peerEchoParams
+	Served string `json:"served"`
+}
+
+func newPipedPeers(t *testing.T) (*MocaJsonRPCCtx, *MocaJsonRPCCtx) {
+	t.Helper()
+
+	corectx := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(corectx.GlobalContextCancel)
+
+	a := corectx.NewPeer(&MocaRPCSession{ID: "a"}, nil)
+	b := corectx.NewPeer(&MocaRPCSession{ID: "b"}, nil)
+	t.Cleanup(a.Close)
+	t.Cleanup(b.Close)
+
+	for _, peer := range []*MocaJsonRPCCtx{a, b} {
+		peer.RegisterMethod("echo", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+			var params peerEchoParams
+			if code, err := in.ParseParams(in.Params, &params); err != nil {
+				return nil, code, err
+			}
+			return peer.RsponseBuilder(in.ID, nil, &peerEchoResult{peerEchoParams: params, Served: peer.Session.ID}), 0, nil
+		})
+	}
+	Pipe(a, b)
+
+	return a, b
+}
+
+func TestPeerConcurrentCalls(t *testing.T) {
+	a, b := newPipedPeers(t)
+
+	const workers, calls = 8, 50
+
+	var wg sync.WaitGroup
+	for _, dir := range []struct{ from, to *MocaJsonRPCCtx }{{a, b}, {b, a}} {
+		for worker := range workers {
+			wg.Go(func() {
+				for seq := range calls {
+					params := peerEchoParams{From: fmt.Sprintf("%s-%d", dir.from.Session.ID, worker), Seq: seq}
+
+					res, err := dir.from.Call(context.Background(), dir.from.RequestBuilder(nil, "echo", params))
+					if err != nil {
+						t.Errorf("%s call %d: %v", params.From, seq, err)
+						return
+					}
+					if res.Error != nil {
+						t.Errorf("%s call %d: rpc error %+v", params.From, seq, res.Error)
+						return
+					}
+
+					var result peerEchoResult
+					if _, err := res.ParseParams(res.Result, &result); err != nil {
+						t.Errorf("%s call %d: %v", params.From, seq, err)
+						return
+					}
+					if result.peerEchoParams != params || result.Served != dir.to.Session.ID {
+						t.Errorf("%s call %d: got %+v served by %s", params.From, seq, result.peerEchoParams, result.Served)
+						return
+					}
+				}
+			})
+		}
+	}
+	wg.Wait()
+}
+
+func TestPeerCloseCancelsPendingCalls(t *testing.T) {
+	a, b := newPipedPeers(t)
+
+	release := make(chan struct{})
+	b.RegisterMethod("block", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+		<-release
+		return b.RsponseBuilder(in.ID, nil, true), 0, nil
+	})
+	defer close(release)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Call(context.Background(), a.RequestBuilder(nil, "block"))
+		done <- err
+	}()
+
+	a.Close()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("pending call returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPeerIDGenerator(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		generator func() any
+		want      func(id string) bool
+	}{
+		{name: "int", generator: NewIntIDGenerator(), want: func(id string) bool { return id == "1" }},
+		{name: "uuid", generator: UUIDGenerator, want: func(id string) bool { return len(id) == 38 && id[0] == '"' }},
+		{name: "custom", generator: func() any { return "parent-id" }, want: func(id string) bool { return id == `"parent-id"` }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			corectx := InitMocaJsonRPCCtx(context.Background())
+			t.Cleanup(corectx.GlobalContextCancel)
+			corectx.IDGenerator = test.generator
+
+			peer := corectx.NewPeer(&MocaRPCSession{ID: "a"}, nil)
+			t.Cleanup(peer.Close)
+
+			if id := string(peer.NextID()); !test.want(id) {
+				t.Errorf("id %s of the peer is not from the generator of the parent", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package mocarpc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ProgressMethod notification method for progress updates, params is `MocaRPCProgress`
+const ProgressMethod = "$/progress"
+
+type MocaRPCProgress struct {
+	ID         json.RawMessage `json:"id"`
+	Percentage float64         `json:"percentage"`
+	Message    string          `json:"message,omitempty"`
+}
+
+// NotifyProgress send a progress update of request `in` to the caller, call it in method handlers
+func (corectx *MocaJsonRPCCtx) NotifyProgress(in *MocaJsonRPCBase, percentage float64, message string) error {
+	if in == nil || in.ID == nil {
+		return errors.New("mockrpc: progress of a notification")
+	}
+
+	if corectx.WriteMessage == nil {
+		return errors.New("mockrpc: WriteMessage is nil")
+	}
+
+	notification := corectx.RequestBuilder(nil, ProgressMethod, &MocaRPCProgress{
+		ID:         in.ID,
+		Percentage: percentage,
+		Message:    message,
+	})
+
+	messageBytes, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return corectx.WriteMessage(in.ReadID, 0, messageBytes)
+}
+
+// onProgress handler of `ProgressMethod`, forwards the update to the pending `Call`
+func (corectx *MocaJsonRPCCtx) onProgress(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+	progress := new(MocaRPCProgress)
+	if code, err := in.ParseParams(in.Params, progress); err != nil {
+		return nil, code, err
+	}
+
+	syncCall := corectx.SyncMap.Get(NormalizeID(progress.ID))
+	if syncCall == nil || syncCall.Value().ProgressChan == nil {
+		corectx.logger().Debug("progress_unmatched", "id", string(progress.ID))
+		return nil, 0, nil
+	}
+
+	select {
+	case syncCall.Value().ProgressChan <- progress:
+	case <-syncCall.Value().Ctx.Done():
+	}
+
+	return nil, 0, nil
+}
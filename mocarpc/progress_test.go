@@ -0,0 +1,74 @@
+package mocarpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallWithProgressTimeout(t *testing.T) {
+	const timeout, interval = time.Millisecond * 200, time.Millisecond * 50
+
+	for _, test := range []struct {
+		name    string
+		updates int
+		stall   bool // stop sending progress before the response
+	}{
+		// the call outlives the timeout while progress keeps arriving
+		{name: "progressing", updates: 8},
+		{name: "stalled", updates: 2, stall: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := newPipedPeers(t)
+			a.CallTimeout = timeout
+
+			release := make(chan struct{})
+			defer close(release)
+			b.RegisterMethod("export", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+				for i := range test.updates {
+					time.Sleep(interval)
+					if err := b.NotifyProgress(in, float64(i+1)/float64(test.updates)*100, "exporting"); err != nil {
+						return nil, InternalError, err
+					}
+				}
+				if test.stall {
+					<-release
+				}
+				return b.RsponseBuilder(in.ID, nil, "done"), 0, nil
+			})
+
+			updates := 0
+			start := time.Now()
+			res, err := a.CallWithProgress(context.Background(), a.RequestBuilder(nil, "export"), func(progress *MocaRPCProgress) {
+				updates++
+			})
+			elapsed := time.Since(start)
+
+			if updates != test.updates {
+				t.Errorf("%d progress updates, want %d", updates, test.updates)
+			}
+
+			if test.stall {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("stalled call returned %v, want %v", err, context.DeadlineExceeded)
+				}
+				// the timeout restarts at the last update
+				if elapsed < interval*time.Duration(test.updates)+timeout {
+					t.Errorf("timed out after %v, before the timeout after the last update", elapsed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Error != nil || string(res.Result) != `"done"` {
+				t.Errorf("response %s %v", res.Result, res.Error)
+			}
+			if elapsed <= timeout {
+				t.Errorf("call finished in %v, within the timeout without progress", elapsed)
+			}
+		})
+	}
+}
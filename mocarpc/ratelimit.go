@@ -0,0 +1,186 @@
+package mocarpc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitScopeConn   = "conn"   // one bucket per connection (`MocaRPCSession.ID`)
+	RateLimitScopeMethod = "method" // one bucket shared by all callers
+	// any other scope is treated as a `MocaRPCSession.Store` key, e.g. "user_id",
+	// sessions without the key get a bucket per connection
+)
+
+type MocaRPCRateLimit struct {
+	Scope string
+	Rate  float64 // tokens per second
+	Burst int
+}
+
+type MocaRPCTokenBucket struct {
+	Tokens   float64
+	LastFill time.Time
+
+	session string // released with the session, empty if shared
+
+	mu sync.Mutex
+}
+
+// Take returns 0 if a token was taken, or the time to wait for the next one
+func (bucket *MocaRPCTokenBucket) Take(limit *MocaRPCRateLimit) time.Duration {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	bucket.Tokens += now.Sub(bucket.LastFill).Seconds() * limit.Rate
+	bucket.LastFill = now
+	if burst := float64(max(limit.Burst, 1)); bucket.Tokens > burst {
+		bucket.Tokens = burst
+	}
+
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		return 0
+	}
+
+	return time.Duration((1 - bucket.Tokens) / limit.Rate * float64(time.Second))
+}
+
+// refund a token taken by a call rejected by another limit
+func (bucket *MocaRPCTokenBucket) refund(limit *MocaRPCRateLimit) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	bucket.Tokens = min(bucket.Tokens+1, float64(max(limit.Burst, 1)))
+}
+
+// rateLimitRoot peers share the limits and buckets of their parent
+func (corectx *MocaJsonRPCCtx) rateLimitRoot() *MocaJsonRPCCtx {
+	if corectx.Parent != nil {
+		return corectx.Parent
+	}
+	return corectx
+}
+
+// SetRateLimit replace the limits of a method, all limits must pass before the handler is called.
+// Safe to call while serving, peers use the limits of their parent
+func (corectx *MocaJsonRPCCtx) SetRateLimit(method string, limits ...*MocaRPCRateLimit) {
+	root := corectx.rateLimitRoot()
+
+	root.rateLimitsMu.Lock()
+	root.RateLimits[method] = limits
+	root.rateLimitsMu.Unlock()
+
+	// drop buckets of the old limits
+	for _, key := range root.RateLimitBuckets.Keys() {
+		if strings.HasPrefix(key, method+"\x00") {
+			root.RateLimitBuckets.Delete(key)
+		}
+	}
+}
+
+// TakeRateLimit returns the longest wait time of the exceeded limits, a rejected call takes no token
+func (corectx *MocaJsonRPCCtx) TakeRateLimit(in *MocaJsonRPCBase) (time.Duration, bool) {
+	root := corectx.rateLimitRoot()
+
+	root.rateLimitsMu.RLock()
+	limits := root.RateLimits[in.Method]
+	root.rateLimitsMu.RUnlock()
+	if len(limits) == 0 {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	taken := make(map[*MocaRPCTokenBucket]*MocaRPCRateLimit, len(limits))
+	for i, limit := range limits {
+		if limit == nil || limit.Rate <= 0 {
+			continue
+		}
+
+		scope, scopeValue := limit.Scope, ""
+		if scope != RateLimitScopeMethod && scope != RateLimitScopeConn && in.Session != nil {
+			scopeValue = in.Session.Store[scope]
+		}
+		// an empty attribute must not share one bucket between all sessions without it
+		if scope == RateLimitScopeConn || (scope != RateLimitScopeMethod && scopeValue == "") {
+			if in.Session == nil {
+				continue
+			}
+			scope, scopeValue = RateLimitScopeConn, in.Session.ID
+		}
+
+		var session string
+		if scope == RateLimitScopeConn {
+			session = scopeValue
+		}
+
+		// method \x00 index \x00 scope \x00 value
+		key := in.Method + "\x00" + strconv.Itoa(i) + "\x00" + scope + "\x00" + scopeValue
+		item, _ := root.RateLimitBuckets.GetOrSetFunc(key, func() *MocaRPCTokenBucket {
+			root.indexRateLimitBucket(session, key)
+			return &MocaRPCTokenBucket{
+				Tokens:   float64(max(limit.Burst, 1)),
+				LastFill: time.Now(),
+				session:  session,
+			}
+		})
+
+		if wait := item.Value().Take(limit); wait > 0 {
+			retryAfter = max(retryAfter, wait)
+		} else {
+			taken[item.Value()] = limit
+		}
+	}
+
+	if retryAfter > 0 {
+		for bucket, limit := range taken {
+			bucket.refund(limit)
+		}
+	}
+
+	return retryAfter, retryAfter > 0
+}
+
+// indexRateLimitBucket keep the keys of the buckets of a session for `releaseRateLimitBuckets()`
+func (corectx *MocaJsonRPCCtx) indexRateLimitBucket(session, key string) {
+	if session == "" {
+		return
+	}
+
+	corectx.rateLimitSessionsMu.Lock()
+	defer corectx.rateLimitSessionsMu.Unlock()
+
+	if corectx.rateLimitSessions[session] == nil {
+		corectx.rateLimitSessions[session] = make(map[string]struct{})
+	}
+	corectx.rateLimitSessions[session][key] = struct{}{}
+}
+
+// unindexRateLimitBucket on eviction, a bucket can expire before its session is released
+func (corectx *MocaJsonRPCCtx) unindexRateLimitBucket(session, key string) {
+	if session == "" {
+		return
+	}
+
+	corectx.rateLimitSessionsMu.Lock()
+	defer corectx.rateLimitSessionsMu.Unlock()
+
+	delete(corectx.rateLimitSessions[session], key)
+	if len(corectx.rateLimitSessions[session]) == 0 {
+		delete(corectx.rateLimitSessions, session)
+	}
+}
+
+func (corectx *MocaJsonRPCCtx) releaseRateLimitBuckets(sessionID string) {
+	corectx.rateLimitSessionsMu.Lock()
+	keys := corectx.rateLimitSessions[sessionID]
+	delete(corectx.rateLimitSessions, sessionID)
+	corectx.rateLimitSessionsMu.Unlock()
+
+	for key := range keys {
+		corectx.RateLimitBuckets.Delete(key)
+	}
+}
@@ -0,0 +1,154 @@
+package mocarpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// taken calls allowed of n, the rate of the test limits doesn't refill a token within the test
+func taken(corectx *MocaJsonRPCCtx, method string, session *MocaRPCSession, n int) int {
+	allowed := 0
+	for range n {
+		if _, limited := corectx.TakeRateLimit(&MocaJsonRPCBase{Method: method, Session: session}); !limited {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestRateLimitScopes(t *testing.T) {
+	anonymous := func(id string) *MocaRPCSession { return &MocaRPCSession{ID: id, Store: map[string]string{}} }
+	user := func(id, userID string) *MocaRPCSession {
+		return &MocaRPCSession{ID: id, Store: map[string]string{"user_id": userID}}
+	}
+
+	for _, test := range []struct {
+		name     string
+		scope    string
+		sessions []*MocaRPCSession
+		want     []int
+	}{
+		{name: "conn", scope: RateLimitScopeConn, sessions: []*MocaRPCSession{anonymous("a"), anonymous("b")}, want: []int{2, 2}},
+		{name: "conn_without_session", scope: RateLimitScopeConn, sessions: []*MocaRPCSession{nil}, want: []int{5}},
+		{name: "method", scope: RateLimitScopeMethod, sessions: []*MocaRPCSession{anonymous("a"), anonymous("b"), nil}, want: []int{2, 0, 0}},
+		{name: "store", scope: "user_id", sessions: []*MocaRPCSession{user("a", "u1"), user("b", "u1"), user("c", "u2")}, want: []int{2, 0, 2}},
+		// sessions without the attribute don't share a bucket
+		{name: "store_empty", scope: "user_id", sessions: []*MocaRPCSession{anonymous("a"), anonymous("b"), user("c", "")}, want: []int{2, 2, 2}},
+		{name: "store_without_session", scope: "user_id", sessions: []*MocaRPCSession{nil}, want: []int{5}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			corectx := InitMocaJsonRPCCtx(context.Background())
+			t.Cleanup(corectx.GlobalContextCancel)
+			corectx.SetRateLimit("echo", &MocaRPCRateLimit{Scope: test.scope, Rate: 0.001, Burst: 2})
+
+			for i, session := range test.sessions {
+				if allowed := taken(corectx, "echo", session, 5); allowed != test.want[i] {
+					t.Errorf("session %d: %d calls allowed, want %d", i, allowed, test.want[i])
+				}
+			}
+			if allowed := taken(corectx, "other", test.sessions[0], 5); allowed != 5 {
+				t.Errorf("%d calls of a method without limits allowed", allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimitAllLimitsApply(t *testing.T) {
+	corectx := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(corectx.GlobalContextCancel)
+	corectx.SetRateLimit("echo",
+		&MocaRPCRateLimit{Scope: RateLimitScopeConn, Rate: 0.001, Burst: 3},
+		&MocaRPCRateLimit{Scope: RateLimitScopeMethod, Rate: 0.001, Burst: 4},
+	)
+
+	a, b := &MocaRPCSession{ID: "a"}, &MocaRPCSession{ID: "b"}
+	if allowed := taken(corectx, "echo", a, 5); allowed != 3 {
+		t.Errorf("a: %d calls allowed, want 3 of its connection", allowed)
+	}
+	if allowed := taken(corectx, "echo", b, 5); allowed != 1 {
+		t.Errorf("b: %d calls allowed, want 1 left of the method", allowed)
+	}
+
+	// new limits start with new buckets
+	corectx.SetRateLimit("echo", &MocaRPCRateLimit{Scope: RateLimitScopeMethod, Rate: 0.001, Burst: 2})
+	if allowed := taken(corectx, "echo", a, 5); allowed != 2 {
+		t.Errorf("%d calls allowed after SetRateLimit, want 2", allowed)
+	}
+}
+
+func TestRateLimitReleaseSession(t *testing.T) {
+	corectx := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(corectx.GlobalContextCancel)
+	corectx.SetRateLimit("echo",
+		&MocaRPCRateLimit{Scope: RateLimitScopeConn, Rate: 0.001, Burst: 1},
+		&MocaRPCRateLimit{Scope: "user_id", Rate: 0.001, Burst: 1},
+		&MocaRPCRateLimit{Scope: RateLimitScopeMethod, Rate: 0.001, Burst: 10},
+	)
+
+	a := &MocaRPCSession{ID: "a", Store: map[string]string{}}
+	b := &MocaRPCSession{ID: "b", Store: map[string]string{"user_id": "u1"}}
+	taken(corectx, "echo", a, 2)
+	taken(corectx, "echo", b, 2)
+
+	// a: conn and its fallback of user_id, b: conn, shared: user_id u1 and method
+	if buckets := corectx.RateLimitBuckets.Len(); buckets != 5 {
+		t.Fatalf("%d buckets, want 5", buckets)
+	}
+	if keys := len(corectx.rateLimitSessions["a"]); keys != 2 {
+		t.Errorf("%d buckets indexed for a, want 2", keys)
+	}
+
+	corectx.ReleaseSession("a")
+	if buckets := corectx.RateLimitBuckets.Len(); buckets != 3 {
+		t.Errorf("%d buckets after releasing a, want 3", buckets)
+	}
+	if _, ok := corectx.rateLimitSessions["a"]; ok {
+		t.Error("a is still indexed")
+	}
+	if allowed := taken(corectx, "echo", a, 2); allowed != 1 {
+		t.Errorf("a: %d calls allowed after the release, want a new burst of 1", allowed)
+	}
+	if allowed := taken(corectx, "echo", b, 1); allowed != 0 {
+		t.Errorf("b: %d calls allowed, its buckets are kept", allowed)
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	corectx := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(corectx.GlobalContextCancel)
+	corectx.RegisterMethod("echo", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+		return corectx.RsponseBuilder(in.ID, nil, "ok"), 0, nil
+	})
+	corectx.SetRateLimit("echo", &MocaRPCRateLimit{Scope: RateLimitScopeConn, Rate: 2, Burst: 1})
+
+	client := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(client.GlobalContextCancel)
+	server := corectx.NewPeer(&MocaRPCSession{ID: "a"}, nil)
+	Pipe(client, server)
+
+	if res, err := client.Call(context.Background(), client.RequestBuilder(nil, "echo")); err != nil || res.Error != nil {
+		t.Fatalf("first call: %v %+v", err, res)
+	}
+	res, err := client.Call(context.Background(), client.RequestBuilder(nil, "echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error == nil || res.Error.Code != RateLimited {
+		t.Fatalf("second call returned %+v, want code %d", res.Error, RateLimited)
+	}
+
+	var data struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	raw, _ := json.Marshal(res.Error.Data)
+	if err = json.Unmarshal(raw, &data); err != nil || data.RetryAfter <= 0 || data.RetryAfter > 0.5 {
+		t.Errorf("error data %s, want retry_after within the refill of 0.5s", raw)
+	}
+
+	// closing the peer releases its buckets in the parent
+	server.Close()
+	if buckets := corectx.RateLimitBuckets.Len(); buckets != 0 {
+		t.Errorf("%d buckets after the peer was closed", buckets)
+	}
+}
@@ -8,31 +8,62 @@ import (
 	"errors"
 	"time"
 
-	"github.com/jellydator/ttlcache/v3"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
 )
 
 type SyncMocaRPCType struct {
 	ID                string
 	CallbackChan      chan *MocaJsonRPCResponse
 	CallbackBatchChan chan []*MocaJsonRPCResponse
+	ProgressChan      chan *MocaRPCProgress
 
 	// ctx
 	Ctx       context.Context
 	CtxCancel context.CancelFunc
 }
 
+func (corectx *MocaJsonRPCCtx) callTimeout() time.Duration {
+	if corectx.CallTimeout > 0 {
+		return corectx.CallTimeout
+	}
+	return time.Second * 10
+}
+
 // TODO not yet support batch
 func (corectx *MocaJsonRPCCtx) Call(ctx context.Context, message *MocaJsonRPCBase) (*MocaJsonRPCResponse, error) {
+	return corectx.CallWithProgress(ctx, message, nil)
+}
+
+// CallWithProgress like `Call`, `onProgress` is called for each `ProgressMethod` update of the request, and the timeout restarts after each update.
+// The trace context of ctx is sent in `traceparent`, under the `mocarpc.call` span if `Tracer` is set
+func (corectx *MocaJsonRPCCtx) CallWithProgress(ctx context.Context, message *MocaJsonRPCBase, onProgress func(*MocaRPCProgress)) (*MocaJsonRPCResponse, error) {
 	if message == nil {
 		return nil, errors.New("mockrpc: message is nil")
 	}
 
+	ctx, span := mtctrace.Start(corectx.Tracer, ctx, "mocarpc.call", mtctrace.String("rpc.method", message.Method))
+	defer span.End()
+	if traceparent := mtctrace.Inject(ctx); traceparent != "" {
+		message.TraceParent = traceparent
+	}
+
+	start := time.Now()
+	response, err := corectx.callWithProgress(ctx, message, onProgress)
+	corectx.metrics().calledRemote(message.Method, response, err, time.Since(start))
+
+	span.SetAttr("rpc.code", callCode(response, err))
+	span.RecordError(err)
+
+	return response, err
+}
+
+func (corectx *MocaJsonRPCCtx) callWithProgress(ctx context.Context, message *MocaJsonRPCBase, onProgress func(*MocaRPCProgress)) (*MocaJsonRPCResponse, error) {
 	if corectx.WriteMessage == nil {
 		return nil, errors.New("mockrpc: WriteMessage is nil")
 	}
 
 	if message.ID == nil {
-		return nil, errors.New("mockrpc: message ID is nil")
+		message.ID = corectx.NextID()
 	}
 
 	messageBytes, err := json.Marshal(message)
@@ -40,29 +71,56 @@ func (corectx *MocaJsonRPCCtx) Call(ctx context.Context, message *MocaJsonRPCBas
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timeout := corectx.callTimeout()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	syncRPCStruct := &SyncMocaRPCType{
-		ID:           string(message.ID),
+		ID:           NormalizeID(message.ID),
 		Ctx:          ctx,
 		CtxCancel:    cancel,
 		CallbackChan: make(chan *MocaJsonRPCResponse, 1),
+		ProgressChan: make(chan *MocaRPCProgress, 16),
 	}
 	// defer close(syncRPCStruct.CallbackChan)
 
-	corectx.SyncMap.Set(syncRPCStruct.ID, syncRPCStruct, ttlcache.DefaultTTL)
+	corectx.SyncMap.Set(syncRPCStruct.ID, syncRPCStruct, timeout+time.Second)
 	defer corectx.SyncMap.Delete(syncRPCStruct.ID)
 
 	if err = corectx.WriteMessage(syncRPCStruct.ID, 0, messageBytes); err != nil {
 		return nil, err
 	}
 
-	select {
-	case response := <-syncRPCStruct.CallbackChan:
-		cancel()
-		return response, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	for {
+		select {
+		case response := <-syncRPCStruct.CallbackChan:
+			// updates read before the response
+			for {
+				select {
+				case progress := <-syncRPCStruct.ProgressChan:
+					if onProgress != nil {
+						onProgress(progress)
+					}
+				default:
+					return response, nil
+				}
+			}
+		case progress := <-syncRPCStruct.ProgressChan:
+			if onProgress != nil {
+				onProgress(progress)
+			}
+			timer.Reset(timeout)
+			corectx.SyncMap.Touch(syncRPCStruct.ID)
+		case <-timer.C:
+			return nil, context.DeadlineExceeded
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-corectx.GlobalContext.Done():
+			return nil, context.Canceled
+		}
 	}
 }
 
@@ -76,7 +134,7 @@ func (corectx *MocaJsonRPCCtx) CallBatch(ctx context.Context, message []*MocaJso
 	}
 
 	if message[0].ID == nil {
-		return nil, errors.New("mockrpc: message ID is nil")
+		message[0].ID = corectx.NextID()
 	}
 
 	messageBytes, err := json.Marshal(message)
@@ -84,17 +142,18 @@ func (corectx *MocaJsonRPCCtx) CallBatch(ctx context.Context, message []*MocaJso
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	timeout := corectx.callTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 
 	syncRPCStruct := &SyncMocaRPCType{
-		ID:                string(message[0].ID),
+		ID:                NormalizeID(message[0].ID),
 		Ctx:               ctx,
 		CtxCancel:         cancel,
 		CallbackBatchChan: make(chan []*MocaJsonRPCResponse, 1),
 	}
 	// defer close(syncRPCStruct.CallbackBatchChan)
 
-	corectx.SyncMap.Set(syncRPCStruct.ID, syncRPCStruct, ttlcache.DefaultTTL)
+	corectx.SyncMap.Set(syncRPCStruct.ID, syncRPCStruct, timeout+time.Second)
 	defer corectx.SyncMap.Delete(syncRPCStruct.ID)
 
 	if err = corectx.WriteMessage(syncRPCStruct.ID, 0, messageBytes); err != nil {
@@ -107,5 +166,7 @@ func (corectx *MocaJsonRPCCtx) CallBatch(ctx context.Context, message []*MocaJso
 		return response, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
+	case <-corectx.GlobalContext.Done():
+		return nil, context.Canceled
 	}
 }
@@ -0,0 +1,82 @@
+package mocarpc
+
+import (
+	"context"
+	"testing"
+
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+)
+
+func TestCallPropagatesTraceParent(t *testing.T) {
+	client := InitMocaJsonRPCCtx(context.Background())
+	server := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(client.GlobalContextCancel)
+	t.Cleanup(server.GlobalContextCancel)
+
+	clientRecorder, serverRecorder := mtctrace.NewRecorder(0), mtctrace.NewRecorder(0)
+	client.Tracer, server.Tracer = clientRecorder, serverRecorder
+
+	server.RegisterMethod("echo", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+		return server.RsponseBuilder(in.ID, nil, "ok"), 0, nil
+	})
+	Pipe(client, server)
+
+	res, err := client.Call(context.Background(), client.RequestBuilder(nil, "echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != nil {
+		t.Fatalf("rpc error %+v", res.Error)
+	}
+
+	// the handler span ends before the response is written
+	clientSpans, serverSpans := clientRecorder.Spans(), serverRecorder.Spans()
+	if len(clientSpans) != 1 || clientSpans[0].Name != "mocarpc.call" {
+		t.Fatalf("client spans %+v, want one mocarpc.call", clientSpans)
+	}
+	if len(serverSpans) != 1 || serverSpans[0].Name != "mocarpc.handle" {
+		t.Fatalf("server spans %+v, want one mocarpc.handle", serverSpans)
+	}
+
+	call, handle := clientSpans[0], serverSpans[0]
+	if call.ParentID != "" {
+		t.Errorf("call span has parent %q, want a root span", call.ParentID)
+	}
+	if handle.TraceID != call.TraceID {
+		t.Errorf("handle span trace %q, want %q", handle.TraceID, call.TraceID)
+	}
+	if handle.ParentID != call.SpanID {
+		t.Errorf("handle span parent %q, want the call span %q", handle.ParentID, call.SpanID)
+	}
+	for _, span := range []*mtctrace.RecordedSpan{call, handle} {
+		if span.Attrs["rpc.method"] != "echo" || span.Attrs["rpc.code"] != "0" {
+			t.Errorf("%s attrs %v", span.Name, span.Attrs)
+		}
+	}
+}
+
+func TestCallContinuesTraceOfContext(t *testing.T) {
+	client := InitMocaJsonRPCCtx(context.Background())
+	server := InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(client.GlobalContextCancel)
+	t.Cleanup(server.GlobalContextCancel)
+
+	// untraced cores still forward the trace context of the caller
+	var handlerTraceParent string
+	server.RegisterMethod("echo", func(in *MocaJsonRPCBase) (*MocaJsonRPCBase, int, error) {
+		handlerTraceParent = mtctrace.Inject(in.Ctx)
+		return server.RsponseBuilder(in.ID, nil, "ok"), 0, nil
+	})
+	Pipe(client, server)
+
+	recorder := mtctrace.NewRecorder(0)
+	ctx, root := recorder.Start(context.Background(), "root")
+	if _, err := client.Call(ctx, client.RequestBuilder(nil, "echo")); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	if want := mtctrace.Inject(ctx); handlerTraceParent != want {
+		t.Errorf("handler traceparent %q, want %q", handlerTraceParent, want)
+	}
+}
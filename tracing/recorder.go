@@ -0,0 +1,150 @@
+package mtctrace
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RecordedSpan a finished span of `Recorder`
+type RecordedSpan struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string // empty for root spans
+	Attrs    map[string]string
+	Errors   []string
+	Start    time.Time
+	End      time.Time
+}
+
+// Recorder in-memory tracer keeping the last `Size` finished spans, for tests and debugging
+type Recorder struct {
+	Size int // 1000 by default
+
+	spans []*RecordedSpan
+
+	mu sync.Mutex
+}
+
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Recorder{Size: size}
+}
+
+func (recorder *Recorder) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := NewSpanContext(parent)
+
+	span := &recordedSpan{
+		recorder: recorder,
+		sc:       sc,
+		data: &RecordedSpan{
+			Name:    name,
+			TraceID: sc.TraceID,
+			SpanID:  sc.SpanID,
+			Attrs:   make(map[string]string, len(attrs)),
+			Start:   time.Now(),
+		},
+	}
+	if parent.IsValid() {
+		span.data.ParentID = parent.SpanID
+	}
+	for _, attr := range attrs {
+		span.data.Attrs[attr.Key] = attr.Value
+	}
+
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Spans finished spans, oldest first
+func (recorder *Recorder) Spans() []*RecordedSpan {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	return slices.Clone(recorder.spans)
+}
+
+// Trace finished spans of a trace, oldest first
+func (recorder *Recorder) Trace(traceID string) []*RecordedSpan {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	spans := []*RecordedSpan{}
+	for _, span := range recorder.spans {
+		if span.TraceID == traceID {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func (recorder *Recorder) Reset() {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.spans = nil
+}
+
+func (recorder *Recorder) record(span *RecordedSpan) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.spans = append(recorder.spans, span)
+	if size := max(recorder.Size, 1); len(recorder.spans) > size {
+		recorder.spans = slices.Clone(recorder.spans[len(recorder.spans)-size:])
+	}
+}
+
+type recordedSpan struct {
+	recorder *Recorder
+	sc       SpanContext
+	data     *RecordedSpan
+	ended    bool
+
+	mu sync.Mutex
+}
+
+func (span *recordedSpan) SetAttr(key, value string) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	span.data.Attrs[key] = value
+}
+
+func (span *recordedSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	span.data.Errors = append(span.data.Errors, err.Error())
+}
+
+func (span *recordedSpan) SpanContext() SpanContext {
+	return span.sc
+}
+
+// End records the span once
+func (span *recordedSpan) End() {
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+
+	data := *span.data
+	data.Attrs = maps.Clone(span.data.Attrs)
+	data.Errors = slices.Clone(span.data.Errors)
+	data.End = time.Now()
+	span.mu.Unlock()
+
+	span.recorder.record(&data)
+}
@@ -0,0 +1,117 @@
+package mtctrace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Tracer set on `WsCoreCtx`, `RTCCoreCtx` or `MocaJsonRPCCtx` to record spans, nil disables tracing.
+// `Recorder` is built in, adapt other tracers (e.g. OpenTelemetry) by implementing it
+type Tracer interface {
+	// Start a span, the parent is the span of ctx or the remote parent from `Extract()`
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttr(key, value string)
+	RecordError(err error)
+	SpanContext() SpanContext
+	End()
+}
+
+type Attr struct {
+	Key   string
+	Value string
+}
+
+func String(key, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// SpanContext ids in lower hex, 32 characters for the trace and 16 for the span
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) == 32 && len(sc.SpanID) == 16 &&
+		strings.Trim(sc.TraceID, "0") != "" && strings.Trim(sc.SpanID, "0") != ""
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext the parent of spans started with the returned ctx, for tracers implementing `Tracer`
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Inject the `traceparent` (W3C trace context) of the span in ctx, empty without a span
+func Inject(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+// Extract the remote parent from `traceparent`, ctx is returned as is if it's invalid
+func Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	if !sc.IsValid() || !isLowerHex(sc.TraceID) || !isLowerHex(sc.SpanID) {
+		return ctx
+	}
+
+	return ContextWithSpanContext(ctx, sc)
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewSpanContext a child of parent, or a new trace if parent is invalid
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newID(8)}
+	if !parent.IsValid() {
+		sc.TraceID = newID(16)
+	}
+	return sc
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttr(key, value string) {}
+func (noopSpan) RecordError(err error)     {}
+func (noopSpan) SpanContext() SpanContext  { return SpanContext{} }
+func (noopSpan) End()                      {}
+
+// Start with a nil tracer returns ctx and a no-op span
+func Start(tracer Tracer, ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name, attrs...)
+}
@@ -0,0 +1,258 @@
+package mtcwebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrQueueFull  = errors.New("webhook: queue is full")
+	ErrNotRunning = errors.New("webhook: dispatcher is not running")
+)
+
+// Dispatcher posts signed batches of events to each of `URLs`, set the options before `Start()`.
+// Every url has its own bounded queue and worker, a slow endpoint only delays itself
+type Dispatcher struct {
+	URLs   []string
+	Secret []byte // hmac key of `SignatureHeader`
+
+	Client        *http.Client  // 10s timeout by default
+	QueueSize     int           // events per url, 10000 by default, `Dispatch` drops events when full
+	BatchSize     int           // 100 by default
+	BatchInterval time.Duration // max wait to fill a batch, 1s by default
+	MaxRetries    int           // retries of network errors, 429 and 5xx, 3 by default, < 0 disables
+	RetryBackoff  time.Duration // doubled after each retry, 500ms by default
+
+	// a batch dropped after the retries, or events dropped by a full queue
+	OnError func(url string, events []*Event, err error)
+
+	workers []*webhookWorker
+	running atomic.Bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+type webhookWorker struct {
+	url   string
+	queue chan *Event
+}
+
+func NewDispatcher(secret []byte, urls ...string) *Dispatcher {
+	return &Dispatcher{URLs: urls, Secret: secret}
+}
+
+func (dispatcher *Dispatcher) Start() {
+	dispatcher.mu.Lock()
+	defer dispatcher.mu.Unlock()
+
+	if dispatcher.running.Load() {
+		return
+	}
+
+	if dispatcher.Client == nil {
+		dispatcher.Client = &http.Client{Timeout: time.Second * 10}
+	}
+	if dispatcher.QueueSize <= 0 {
+		dispatcher.QueueSize = 10000
+	}
+	if dispatcher.BatchSize <= 0 {
+		dispatcher.BatchSize = 100
+	}
+	if dispatcher.BatchInterval <= 0 {
+		dispatcher.BatchInterval = time.Second
+	}
+	if dispatcher.MaxRetries == 0 {
+		dispatcher.MaxRetries = 3
+	}
+	if dispatcher.RetryBackoff <= 0 {
+		dispatcher.RetryBackoff = time.Millisecond * 500
+	}
+
+	dispatcher.ctx, dispatcher.cancel = context.WithCancel(context.Background())
+	dispatcher.workers = make([]*webhookWorker, 0, len(dispatcher.URLs))
+	for _, url := range dispatcher.URLs {
+		worker := &webhookWorker{url: url, queue: make(chan *Event, dispatcher.QueueSize)}
+		dispatcher.workers = append(dispatcher.workers, worker)
+		dispatcher.wg.Go(func() {
+			dispatcher.run(worker)
+		})
+	}
+
+	dispatcher.running.Store(true)
+}
+
+// Stop flush the queued events until ctx is done, then cancel the pending requests
+func (dispatcher *Dispatcher) Stop(ctx context.Context) error {
+	dispatcher.mu.Lock()
+	if !dispatcher.running.Swap(false) {
+		dispatcher.mu.Unlock()
+		return nil
+	}
+	for _, worker := range dispatcher.workers {
+		close(worker.queue)
+	}
+	dispatcher.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		dispatcher.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		dispatcher.cancel()
+		return nil
+	case <-ctx.Done():
+		dispatcher.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Dispatch queue the event for every url without blocking, `ErrQueueFull` if any queue dropped it
+func (dispatcher *Dispatcher) Dispatch(event *Event) error {
+	dispatcher.mu.RLock()
+	defer dispatcher.mu.RUnlock()
+
+	if !dispatcher.running.Load() {
+		return ErrNotRunning
+	}
+
+	var err error
+	for _, worker := range dispatcher.workers {
+		select {
+		case worker.queue <- event:
+		default:
+			dispatcher.dropped.Add(1)
+			if dispatcher.OnError != nil {
+				dispatcher.OnError(worker.url, []*Event{event}, ErrQueueFull)
+			}
+			err = ErrQueueFull
+		}
+	}
+	return err
+}
+
+// Sent events delivered, counted per url
+func (dispatcher *Dispatcher) Sent() uint64 {
+	return dispatcher.sent.Load()
+}
+
+// Dropped events dropped by full queues
+func (dispatcher *Dispatcher) Dropped() uint64 {
+	return dispatcher.dropped.Load()
+}
+
+// Failed events given up after the retries
+func (dispatcher *Dispatcher) Failed() uint64 {
+	return dispatcher.failed.Load()
+}
+
+func (dispatcher *Dispatcher) run(worker *webhookWorker) {
+	timer := time.NewTimer(dispatcher.BatchInterval)
+	timer.Stop()
+
+	batch := make([]*Event, 0, dispatcher.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			dispatcher.deliver(worker.url, batch)
+			batch = make([]*Event, 0, dispatcher.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-worker.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(dispatcher.BatchInterval)
+			}
+			batch = append(batch, event)
+			if len(batch) >= dispatcher.BatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// deliver with retries, dropped if the dispatcher is canceled
+func (dispatcher *Dispatcher) deliver(url string, events []*Event) {
+	body, err := json.Marshal(&Batch{Events: events})
+	if err == nil {
+		backoff := dispatcher.RetryBackoff
+		for attempt := 0; ; attempt++ {
+			var retry bool
+			if retry, err = dispatcher.post(url, body); err == nil {
+				dispatcher.sent.Add(uint64(len(events)))
+				return
+			}
+			if !retry || attempt >= dispatcher.MaxRetries {
+				break
+			}
+
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-dispatcher.ctx.Done():
+				err = dispatcher.ctx.Err()
+			}
+			if dispatcher.ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	dispatcher.failed.Add(uint64(len(events)))
+	if dispatcher.OnError != nil {
+		dispatcher.OnError(url, events, err)
+	}
+}
+
+// post returns whether a failed request should be retried
+func (dispatcher *Dispatcher) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(dispatcher.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(dispatcher.Secret, timestamp, body))
+
+	res, err := dispatcher.Client.Do(req)
+	if err != nil {
+		return dispatcher.ctx.Err() == nil, err
+	}
+	// drained to reuse the connection
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook: %s responded %s", url, res.Status)
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
@@ -0,0 +1,294 @@
+package mtcwebhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+// webhookReceiver verifies every request and answers with `statuses` in order, then 200
+type webhookReceiver struct {
+	*httptest.Server
+
+	statuses []int
+	block    chan struct{} // requests wait until closed if set
+
+	batches  chan *Batch
+	requests int
+	mu       sync.Mutex
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+
+	receiver := &webhookReceiver{statuses: statuses, batches: make(chan *Batch, 100)}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batch, err := ReadBatch(testSecret, r, time.Minute)
+		if err != nil {
+			t.Errorf("read batch: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		receiver.mu.Lock()
+		status := http.StatusOK
+		if receiver.requests < len(receiver.statuses) {
+			status = receiver.statuses[receiver.requests]
+		}
+		receiver.requests++
+		block := receiver.block
+		receiver.mu.Unlock()
+
+		if block != nil {
+			<-block
+		}
+
+		if status == http.StatusOK {
+			receiver.batches <- batch
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver
+}
+
+func (receiver *webhookReceiver) Requests() int {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return receiver.requests
+}
+
+func (receiver *webhookReceiver) nextBatch(t *testing.T) *Batch {
+	t.Helper()
+
+	select {
+	case batch := <-receiver.batches:
+		return batch
+	case <-time.After(time.Second * 5):
+		t.Fatal("no batch received")
+		return nil
+	}
+}
+
+func newTestDispatcher(t *testing.T, url string, configure func(dispatcher *Dispatcher)) *Dispatcher {
+	t.Helper()
+
+	dispatcher := NewDispatcher(testSecret, url)
+	dispatcher.BatchInterval = time.Hour
+	dispatcher.RetryBackoff = time.Millisecond
+	if configure != nil {
+		configure(dispatcher)
+	}
+	dispatcher.Start()
+	t.Cleanup(func() { dispatcher.Stop(context.Background()) })
+
+	return dispatcher
+}
+
+func newTestEvent(nodeID string) *Event {
+	return NewEvent(EventConnected, "ws", "user:"+nodeID+":s", nodeID, "user", time.Now())
+}
+
+func dispatchN(t *testing.T, dispatcher *Dispatcher, n int) []*Event {
+	t.Helper()
+
+	events := make([]*Event, 0, n)
+	for i := range n {
+		event := newTestEvent(string(rune('a' + i)))
+		if err := dispatcher.Dispatch(event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func assertBatch(t *testing.T, batch *Batch, events []*Event) {
+	t.Helper()
+
+	if len(batch.Events) != len(events) {
+		t.Fatalf("batch of %d events, want %d", len(batch.Events), len(events))
+	}
+	for i, event := range events {
+		if got := batch.Events[i]; got.ID != event.ID || got.NodeID != event.NodeID || got.Type != event.Type {
+			t.Errorf("event %d is %+v, want %+v", i, got, event)
+		}
+	}
+}
+
+func TestDispatcherBatchSize(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	dispatcher := newTestDispatcher(t, receiver.URL, func(dispatcher *Dispatcher) {
+		dispatcher.BatchSize = 3
+	})
+
+	events := dispatchN(t, dispatcher, 6)
+	assertBatch(t, receiver.nextBatch(t), events[:3])
+	assertBatch(t, receiver.nextBatch(t), events[3:])
+
+	// counted after the response
+	dispatcher.Stop(context.Background())
+	if sent := dispatcher.Sent(); sent != 6 {
+		t.Errorf("sent %d, want 6", sent)
+	}
+}
+
+func TestDispatcherBatchInterval(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	dispatcher := newTestDispatcher(t, receiver.URL, func(dispatcher *Dispatcher) {
+		dispatcher.BatchInterval = time.Millisecond * 50
+	})
+
+	start := time.Now()
+	events := dispatchN(t, dispatcher, 2)
+	assertBatch(t, receiver.nextBatch(t), events)
+
+	if elapsed := time.Since(start); elapsed < dispatcher.BatchInterval {
+		t.Errorf("batch sent after %s, before the interval %s", elapsed, dispatcher.BatchInterval)
+	}
+}
+
+func TestDispatcherRetry(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	dispatcher := newTestDispatcher(t, receiver.URL, func(dispatcher *Dispatcher) {
+		dispatcher.BatchSize = 1
+	})
+
+	events := dispatchN(t, dispatcher, 1)
+	assertBatch(t, receiver.nextBatch(t), events)
+
+	if requests := receiver.Requests(); requests != 3 {
+		t.Errorf("%d requests, want 3", requests)
+	}
+	dispatcher.Stop(context.Background())
+	if sent, failed := dispatcher.Sent(), dispatcher.Failed(); sent != 1 || failed != 0 {
+		t.Errorf("sent %d failed %d, want 1 and 0", sent, failed)
+	}
+}
+
+func TestDispatcherNoRetryOnClientError(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusBadRequest)
+
+	failures := make(chan error, 1)
+	dispatcher := newTestDispatcher(t, receiver.URL, func(dispatcher *Dispatcher) {
+		dispatcher.BatchSize = 1
+		dispatcher.OnError = func(url string, events []*Event, err error) {
+			failures <- err
+		}
+	})
+
+	dispatchN(t, dispatcher, 1)
+
+	select {
+	case err := <-failures:
+		if !strings.Contains(err.Error(), "400") {
+			t.Errorf("error %v, want the 400 response", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("OnError was not called")
+	}
+
+	if requests := receiver.Requests(); requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+	if failed := dispatcher.Failed(); failed != 1 {
+		t.Errorf("failed %d, want 1", failed)
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	block := make(chan struct{})
+	defer close(block)
+	receiver.mu.Lock()
+	receiver.block = block
+	receiver.mu.Unlock()
+
+	dropped := make(chan []*Event, 1)
+	dispatcher := newTestDispatcher(t, receiver.URL, func(dispatcher *Dispatcher) {
+		dispatcher.BatchSize = 1
+		dispatcher.QueueSize = 1
+		dispatcher.OnError = func(url string, events []*Event, err error) {
+			if errors.Is(err, ErrQueueFull) {
+				dropped <- events
+			}
+		}
+	})
+
+	// the worker is blocked by the first request, the second event fills the queue
+	dispatchN(t, dispatcher, 1)
+	for receiver.Requests() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	dispatchN(t, dispatcher, 1)
+
+	event := newTestEvent("full")
+	if err := dispatcher.Dispatch(event); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Dispatch returned %v, want %v", err, ErrQueueFull)
+	}
+	if events := <-dropped; len(events) != 1 || events[0] != event {
+		t.Errorf("dropped %+v, want the last event", events)
+	}
+	if count := dispatcher.Dropped(); count != 1 {
+		t.Errorf("dropped %d, want 1", count)
+	}
+}
+
+func TestDispatcherStopFlushes(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+
+	dispatcher := NewDispatcher(testSecret, receiver.URL)
+	dispatcher.BatchInterval = time.Hour
+	dispatcher.Start()
+
+	events := dispatchN(t, dispatcher, 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := dispatcher.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertBatch(t, receiver.nextBatch(t), events)
+
+	if err := dispatcher.Dispatch(newTestEvent("late")); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Dispatch after Stop returned %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	body := []byte(`{"events":[]}`)
+	timestamp := time.Now().Unix()
+
+	header := http.Header{}
+	header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	header.Set(SignatureHeader, Sign(testSecret, timestamp, body))
+
+	if err := Verify(testSecret, header, body, time.Minute); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := Verify([]byte("other"), header, body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify with another secret returned %v", err)
+	}
+	if err := Verify(testSecret, header, []byte(`{"events":null}`), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify of a modified body returned %v", err)
+	}
+
+	stale := http.Header{}
+	stale.Set(TimestampHeader, strconv.FormatInt(timestamp-3600, 10))
+	stale.Set(SignatureHeader, Sign(testSecret, timestamp-3600, body))
+	if err := Verify(testSecret, stale, body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify of a stale timestamp returned %v", err)
+	}
+	if err := Verify(testSecret, stale, body, 0); err != nil {
+		t.Errorf("Verify without tolerance: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package mtcwebhook
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+	EventKicked       = "kicked"
+	EventExpired      = "expired"
+)
+
+// DisconnectEvents event types by `disconnect_reason`, other reasons are `EventDisconnected`
+var DisconnectEvents = map[string]string{
+	"kick":          EventKicked,
+	"expired":       EventExpired,
+	"token_expired": EventExpired,
+}
+
+func DisconnectEvent(reason string) string {
+	if eventType, ok := DisconnectEvents[reason]; ok {
+		return eventType
+	}
+	return EventDisconnected
+}
+
+// Event a connection lifecycle event, `Reason` is the `disconnect_reason` of the other types than `connected`
+type Event struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Transport   string    `json:"transport"` // `ws` or `rtc`
+	ConnKey     string    `json:"conn_key"`
+	NodeID      string    `json:"node_id"`
+	ConnType    string    `json:"conn_type"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Time        time.Time `json:"time"`
+}
+
+func NewEvent(eventType, transport, connKey, nodeID, connType string, connectedAt time.Time) *Event {
+	return &Event{
+		ID:          uuid.NewString(),
+		Type:        eventType,
+		Transport:   transport,
+		ConnKey:     connKey,
+		NodeID:      nodeID,
+		ConnType:    connType,
+		ConnectedAt: connectedAt,
+		Time:        time.Now(),
+	}
+}
+
+// Batch the body of a webhook request
+type Batch struct {
+	Events []*Event `json:"events"`
+}
@@ -0,0 +1,19 @@
+package mtcwebhook
+
+import "testing"
+
+func TestDisconnectEvent(t *testing.T) {
+	for reason, want := range map[string]string{
+		"kick":              EventKicked,
+		"expired":           EventExpired,
+		"token_expired":     EventExpired,
+		"shutdown":          EventDisconnected,
+		"remote_close":      EventDisconnected,
+		"heartbeat_timeout": EventDisconnected,
+		"":                  EventDisconnected,
+	} {
+		if got := DisconnectEvent(reason); got != want {
+			t.Errorf("disconnect_reason %q: %s, want %s", reason, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mtcwebhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Mtc-Signature" // `sha256=<hex hmac of "<timestamp>.<body>">`
+	TimestampHeader = "X-Mtc-Timestamp" // unix seconds
+)
+
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// Sign the signature header value of the body sent at timestamp
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify the signature of a received body, tolerance <= 0 skips the timestamp check
+func Verify(secret []byte, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return ErrInvalidSignature
+	}
+
+	signature := header.Get(SignatureHeader)
+	if !strings.HasPrefix(signature, "sha256=") || !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ReadBatch read and verify a webhook request, for receivers
+func ReadBatch(secret []byte, r *http.Request, tolerance time.Duration) (*Batch, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(secret, r.Header, body, tolerance); err != nil {
+		return nil, err
+	}
+
+	batch := new(Batch)
+	if err := json.Unmarshal(body, batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
@@ -6,7 +6,12 @@ import (
 	"log/slog"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
 	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
 	"github.com/pion/webrtc/v4"
 )
@@ -20,14 +25,27 @@ type RTCConnContext struct {
 	Store       map[string]string
 	SignalPool  []*RTCSignal
 	Protocol    string
+	ConnectedAt time.Time
+
+	Heartbeat     mtcws.HeartbeatStats
+	heartbeatOnce sync.Once
+	connected     atomic.Bool
 
 	Ext *RTCCoreCtx
 
+	// peer of `RTCCoreCtx.RPC`, pass rpc messages to `RPC.ReadMessage()`, nil if disabled
+	RPC *mocarpc.MocaJsonRPCCtx
+
+	// records of the connection, with `conn_id`, `conn_type` and `protocol`
+	Logger *slog.Logger
+
 	Ctx         context.Context
 	Cancel      context.CancelFunc
 	CloseAction sync.Once
 
-	mu sync.Mutex
+	span    mtctrace.Span
+	mu      sync.Mutex
+	storeMu sync.RWMutex
 }
 
 func (rtcconn *RTCConnContext) CreatePeerChannel(channelName string, ordered bool) error {
@@ -53,28 +71,63 @@ func (rtcconn *RTCConnContext) CreatePeerChannel(channelName string, ordered boo
 
 func (rtcconn *RTCConnContext) InitDataChannel(dc *webrtc.DataChannel) {
 	dc.OnError(func(err error) {
-		slog.Error("mtcrtc", "error", err)
+		rtcconn.Logger.Error("channel_error", "channel", dc.Label(), "error", err)
+	})
+
+	var opened atomic.Bool
+	dc.OnOpen(func() {
+		opened.Store(true)
+		rtcconn.Ext.metrics.channelOpened(rtcconn)
+	})
+	dc.OnClose(func() {
+		if opened.CompareAndSwap(true, false) {
+			rtcconn.Ext.metrics.channelClosed(rtcconn)
+		}
 	})
 
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		if rtcconn.Ext.OnMessage == nil {
+		rtcconn.Heartbeat.Seen()
+		rtcconn.Ext.metrics.received(rtcconn, len(msg.Data))
+
+		if slices.Contains([]string{mtcws.WSPingMessageNum, mtcws.WSPingMessageStr, ""}, string(msg.Data)) {
+			// yes... return void, unless heartbeat is enabled
+			if rtcconn.Ext.HeartbeatInterval > 0 && len(msg.Data) > 0 {
+				dc.SendText(mtcws.WSPongMessageStr)
+			}
 			return
 		}
 
-		if slices.Contains([]string{mtcws.WSPingMessageNum, mtcws.WSPingMessageStr, ""}, string(msg.Data)) {
-			// yes... return void
+		if rtcconn.Ext.HeartbeatInterval > 0 {
+			if frame := mtcws.ParseHeartbeatFrame(msg.Data); frame != nil {
+				if frame.Type == mtcws.HeartbeatFramePong {
+					rtcconn.Heartbeat.Pong(frame.TS)
+				} else if err := dc.Send(mtcws.NewHeartbeatFrame(mtcws.HeartbeatFramePong, frame.TS)); err != nil {
+					rtcconn.Logger.Error("write_failed", "channel", dc.Label(), "error", err)
+				}
+				return
+			}
+		}
+
+		if rtcconn.Ext.OnMessage == nil {
 			return
 		}
 
+		span := rtcconn.startMessageSpan(dc.Label(), len(msg.Data))
+		defer span.End()
+
 		response, err := rtcconn.Ext.OnMessage(rtcconn, msg.Data)
 
 		if err != nil {
-			slog.Error("mtcrtc", "error", err)
+			span.RecordError(err)
+			rtcconn.Logger.Error("handler_failed", "channel", dc.Label(), "error", err)
 		}
 		if len(response) > 0 {
 			// slog.Debug("mtcrtc", "res", response)
 			if err = dc.Send(response); err != nil {
-				slog.Error("mtcrtc", "error", err, "res", response)
+				span.RecordError(err)
+				rtcconn.Logger.Error("write_failed", "channel", dc.Label(), "error", err, "response", response)
+			} else {
+				rtcconn.Ext.metrics.sent(rtcconn, len(response))
 			}
 		}
 	})
@@ -93,7 +146,7 @@ func (rtcconn *RTCConnContext) CreatePeerConnection() error {
 	var err error
 
 	s := webrtc.SettingEngine{
-		LoggerFactory: slogLoggerFactory{},
+		LoggerFactory: slogLoggerFactory{logger: rtcconn.Logger},
 	}
 	api := webrtc.NewAPI(webrtc.WithSettingEngine(s))
 
@@ -169,16 +222,28 @@ func (rtcconn *RTCConnContext) AddICECandidate(signal *RTCSignal) error {
 	return rtcconn.Peer.AddICECandidate(*signal.ICECandidate)
 }
 
-// don't call func Close() directly, use `rtcconn.Ext.WebRTCConnPool.Delete(rtcconn.ConnType + ":" + rtcconn.ID)`
+// ConnKey `conn_type:node_id`, key of `WebRTCConnPool`
+func (rtcconn *RTCConnContext) ConnKey() string {
+	return rtcconn.ConnType + ":" + rtcconn.ID
+}
+
+// don't call func Close() directly, use `rtcconn.Ext.WebRTCConnPool.Delete(rtcconn.ConnKey())`
 func (rtcconn *RTCConnContext) Close() error {
 	<-rtcconn.Ctx.Done()
 	rtcconn.CloseAction.Do(func() {
+		defer func() {
+			rtcconn.Logger.Info("disconnected", "reason", rtcconn.DisconnectReason(), "remote_addr", rtcconn.RemoteAddr())
+		}()
+
 		if rtcconn.Ext.OnDisConnected != nil {
 			if err := rtcconn.Ext.OnDisConnected(rtcconn); err != nil {
-				slog.Error("mtcrtc", "error", err)
+				rtcconn.Logger.Error("disconnect_handler_failed", "error", err)
 			}
 		}
 
+		rtcconn.Ext.Topics.LeaveAll(rtcconn)
+		rtcconn.closeRPC()
+
 		rtcconn.mu.Lock()
 		channels := make([]*webrtc.DataChannel, 0, len(rtcconn.ChannelMap))
 		for _, ch := range rtcconn.ChannelMap {
@@ -188,23 +253,31 @@ func (rtcconn *RTCConnContext) Close() error {
 
 		for _, channel := range channels {
 			if err := channel.Close(); err != nil {
-				slog.Error("mtcrtc", "error", err)
+				rtcconn.Logger.Error("channel_close_failed", "channel", channel.Label(), "error", err)
 			}
 		}
 
 		if rtcconn.Peer != nil {
 			if err := rtcconn.Peer.Close(); err != nil {
-				slog.Error("mtcrtc", "error", err)
+				rtcconn.Logger.Error("peer_close_failed", "error", err)
 			}
 		}
 		// close(rtcconn.LastSignal)
+
+		reason := rtcconn.DisconnectReason()
+		rtcconn.Ext.metrics.closed(rtcconn, reason)
+		// peers which never connected only had signaling
+		if rtcconn.connected.Load() {
+			rtcconn.dispatchWebhook(mtcwebhook.DisconnectEvent(reason))
+		}
+		rtcconn.endConnSpan()
 	})
 	return nil
 }
 
 func (rtcconn *RTCConnContext) SwapSignal(signal *RTCSignal) *RTCSignal {
 	responseSignal := &RTCSignal{
-		ID:   rtcconn.ConnType + ":" + rtcconn.ID,
+		ID:   rtcconn.ConnKey(),
 		Type: "ack",
 	}
 
@@ -271,3 +344,38 @@ func (rtcconn *RTCConnContext) ExportSignalPool() []*RTCSignal {
 
 	return resPool
 }
+
+func (rtcconn *RTCConnContext) MemberKey() string {
+	return "rtc:" + rtcconn.ConnKey()
+}
+
+func (rtcconn *RTCConnContext) Send(data []byte) error {
+	return rtcconn.SendRTCMessage(data)
+}
+
+func (rtcconn *RTCConnContext) JoinTopic(topic string) {
+	rtcconn.Ext.Topics.Join(topic, rtcconn)
+}
+
+func (rtcconn *RTCConnContext) LeaveTopic(topic string) {
+	rtcconn.Ext.Topics.Leave(topic, rtcconn)
+}
+
+func (rtcconn *RTCConnContext) runHeartbeat() {
+	mtcws.RunHeartbeat(rtcconn.Ctx, rtcconn.Ext.HeartbeatInterval, rtcconn.Ext.HeartbeatTimeout, &rtcconn.Heartbeat, func(ts int64) error {
+		return rtcconn.SendRTCMessage(mtcws.NewHeartbeatFrame(mtcws.HeartbeatFramePing, ts))
+	}, func() {
+		rtcconn.CloseWithReason("heartbeat_timeout")
+	})
+}
+
+// CloseWithReason remove the connection from the pool if it wasn't replaced, then close,
+// the first reason wins. Safe to call from any goroutine
+func (rtcconn *RTCConnContext) CloseWithReason(reason string) {
+	connKey := rtcconn.ConnKey()
+	rtcconn.setStoreIfEmpty("disconnect_reason", reason)
+	if item := rtcconn.Ext.WebRTCConnPool.Get(connKey); item != nil && item.Value() == rtcconn {
+		rtcconn.Ext.WebRTCConnPool.Delete(connKey)
+	}
+	rtcconn.Cancel()
+}
@@ -3,9 +3,15 @@ package mtcrtc
 import (
 	"context"
 	"log/slog"
+	"maps"
 	"time"
 
 	"github.com/jellydator/ttlcache/v3"
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -20,9 +26,34 @@ type RTCCoreCtx struct {
 
 	ConnTimeout time.Duration
 
+	// heartbeat, 0 disables. Pings are data channel frames answered by the peer, enable it on both sides
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration // 3 * HeartbeatInterval by default
+
+	// nil disables metrics, set before `Init()`
+	Metrics mtcmetrics.Registry
+	metrics *rtcMetrics
+
+	// spans of connections, messages and broadcasts, nil disables tracing
+	Tracer mtctrace.Tracer
+
+	// lifecycle webhooks, nil disables, share it with `mtcws.WsCoreCtx` to get the events of both
+	Webhooks *mtcwebhook.Dispatcher
+
+	// logging, set before `Init()`, nil uses `slog.Default()`. `DebugSampler` limits high-volume debug records, e.g. broadcast payloads
+	Logger       *slog.Logger
+	DebugSampler *mtcws.LogSampler
+	log          *slog.Logger
+
 	// pool
 	WebRTCConnPool *ttlcache.Cache[string, *RTCConnContext]
 
+	// pub-sub, set `mtcws.WsCoreCtx.Topics` before `Init()` to mix websocket and webrtc members
+	Topics *mtcws.Topics
+
+	// rpc peer of every connection (`RTCConnContext.RPC`), rate limits of a connection are released on disconnect. nil disables
+	RPC *mocarpc.MocaJsonRPCCtx
+
 	// event
 	OnConnected    func(*RTCConnContext) error
 	OnDisConnected func(*RTCConnContext) error
@@ -40,6 +71,7 @@ type RTCSignal struct {
 }
 
 func (corectx *RTCCoreCtx) Init() {
+	corectx.log = mtcws.NewModuleLogger(corectx.Logger, "mtcrtc")
 	corectx.Ctx, corectx.Cancel = context.WithCancel(context.Background())
 
 	// to use empty ICEServerURLs, set []string{}
@@ -54,6 +86,14 @@ func (corectx *RTCCoreCtx) Init() {
 		corectx.TTL = time.Hour * 24
 	}
 
+	if corectx.Topics == nil {
+		corectx.Topics = mtcws.NewTopics()
+	}
+
+	if corectx.Metrics != nil {
+		corectx.metrics = newRTCMetrics(corectx.Metrics)
+	}
+
 	corectx.WebRTCConnPool = ttlcache.New(
 		ttlcache.WithCapacity[string, *RTCConnContext](corectx.ConnSize), // ?
 		ttlcache.WithTTL[string, *RTCConnContext](corectx.TTL),
@@ -64,11 +104,12 @@ func (corectx *RTCCoreCtx) Init() {
 	corectx.WebRTCConnPool.OnEviction(func(ctx context.Context, reason ttlcache.EvictionReason, i *ttlcache.Item[string, *RTCConnContext]) {
 		connCtx := i.Value()
 		defer connCtx.Cancel()
+		// keep the reason of internal disconnections, e.g. `signaling_timeout`
 		if connCtx.Peer != nil && connCtx.MainChannel != nil {
 			if i.IsExpired() {
-				connCtx.Store["disconnect_reason"] = "expired"
+				connCtx.setStoreIfEmpty("disconnect_reason", "expired")
 			} else {
-				connCtx.Store["disconnect_reason"] = "kick"
+				connCtx.setStoreIfEmpty("disconnect_reason", "kick")
 			}
 		}
 	})
@@ -83,7 +124,7 @@ func (corectx *RTCCoreCtx) Stop() error {
 }
 
 func (corectx *RTCCoreCtx) InitEvents(connCtx *RTCConnContext) error {
-	connKey := connCtx.ConnType + ":" + connCtx.ID
+	connKey := connCtx.ConnKey()
 
 	connCtx.Peer.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate != nil {
@@ -105,9 +146,20 @@ func (corectx *RTCCoreCtx) InitEvents(connCtx *RTCConnContext) error {
 	})
 
 	connCtx.Peer.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		slog.Debug("mtcrtc", "state", state, "id", connCtx.ID, "type", connCtx.ConnType)
+		connCtx.Logger.Debug("state_changed", "state", state.String())
 		switch state {
 		case webrtc.PeerConnectionStateConnected:
+			connCtx.Logger.Debug("connected", "remote_addr", connCtx.RemoteAddr())
+			connCtx.Heartbeat.Seen()
+			if connCtx.connected.CompareAndSwap(false, true) {
+				corectx.metrics.connected(connCtx)
+				connCtx.dispatchWebhook(mtcwebhook.EventConnected)
+			}
+			if corectx.HeartbeatInterval > 0 {
+				connCtx.heartbeatOnce.Do(func() {
+					go connCtx.runHeartbeat()
+				})
+			}
 			if corectx.OnConnected != nil {
 				corectx.OnConnected(connCtx)
 			}
@@ -118,7 +170,7 @@ func (corectx *RTCCoreCtx) InitEvents(connCtx *RTCConnContext) error {
 
 	connCtx.Peer.OnDataChannel(func(dc *webrtc.DataChannel) {
 		label := dc.Label()
-		slog.Debug("mtcrtc", "channel", label, "status", "created")
+		connCtx.Logger.Debug("channel_created", "channel", label)
 
 		if !corectx.Server {
 			defer func() {
@@ -153,17 +205,24 @@ func (corectx *RTCCoreCtx) InitWebRTC(_ctx context.Context, nodeID, connType, pr
 		Ext:      corectx,
 		Protocol: protocol,
 
+		ConnectedAt: time.Now(),
+
 		// LastSignal: make(chan *RTCSignal, 100),
 
 		Ctx:    ctx,
 		Cancel: cancel,
-		Store:  store,
+		Store:  maps.Clone(store), // owned by the connection, `mtc-store` may be shared
 
 		ChannelMap: make(map[string]*webrtc.DataChannel),
 	}
+	connCtx.initLogger()
+	connCtx.startConnSpan(_ctx)
+	if corectx.RPC != nil {
+		connCtx.RPC = corectx.RPC.NewPeer(connCtx.RPCSession(), connCtx.SendRTCMessage)
+	}
 	go connCtx.Close()
 
-	connKey := connCtx.ConnType + ":" + connCtx.ID
+	connKey := connCtx.ConnKey()
 
 	// disconnect
 	corectx.WebRTCConnPool.Delete(connKey)
@@ -174,7 +233,7 @@ func (corectx *RTCCoreCtx) InitWebRTC(_ctx context.Context, nodeID, connType, pr
 			select {
 			case <-time.After(corectx.ConnTimeout):
 				if connCtx.MainChannel == nil || connCtx.MainChannel.ReadyState() != webrtc.DataChannelStateOpen {
-					connCtx.Store["disconnect_reason"] = "signaling_timeout"
+					connCtx.SetStore("disconnect_reason", "signaling_timeout")
 					corectx.WebRTCConnPool.Delete(connKey)
 				}
 			case <-ctx.Done():
@@ -182,23 +241,32 @@ func (corectx *RTCCoreCtx) InitWebRTC(_ctx context.Context, nodeID, connType, pr
 		}()
 	}
 
+	if exp, ok := mtcws.TokenExpiry(store); ok {
+		go mtcws.RunTokenExpiry(ctx, exp, func() {
+			connCtx.CloseWithReason("token_expired")
+		})
+	}
+
 	// TODO errors
 	err := connCtx.CreatePeerConnection()
 	if err != nil {
-		slog.Error("mtcrtc", "status", "webrtc-cerate-peer-conn", "error", err)
+		connCtx.Logger.Error("create_peer_failed", "error", err)
+		connCtx.span.RecordError(err)
 		corectx.WebRTCConnPool.Delete(connKey)
 		return nil
 	}
 
 	if err = corectx.InitEvents(connCtx); err != nil {
-		slog.Error("mtcrtc", "status", "webrtc-init-events", "error", err)
+		connCtx.Logger.Error("init_events_failed", "error", err)
+		connCtx.span.RecordError(err)
 		corectx.WebRTCConnPool.Delete(connKey)
 		return nil
 	}
 
 	if corectx.Server {
 		if err = connCtx.CreatePeerChannel("main", false); err != nil {
-			slog.Error("mtcrtc", "status", "webrtc-server-init-mai-channel", "error", err)
+			connCtx.Logger.Error("create_channel_failed", "channel", "main", "error", err)
+			connCtx.span.RecordError(err)
 			corectx.WebRTCConnPool.Delete(connKey)
 			return nil
 		}
@@ -2,10 +2,18 @@ package mtcrtc
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"net/http"
+
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
 )
 
 type RTCCoreCtxServer struct {
 	RTCCoreCtx
+
+	// verifies the signaling request of `AuthServerConn()`, e.g. `mtcws.NewJWTAuthenticator()`
+	Authenticator mtcws.Authenticator
 }
 
 func (corectx *RTCCoreCtxServer) Init() {
@@ -31,3 +39,30 @@ func (corectx *RTCCoreCtxServer) InitServerConn(ctx context.Context, nodeID, con
 
 	return conn, responseSignal
 }
+
+// AuthServerConn `InitServerConn()` with the identity verified by `Authenticator`, the verified `Store` overrides `mtc-store` of ctx.
+// Write `mtcws.AuthErrorStatus(err)` to the response if err is not nil
+func (corectx *RTCCoreCtxServer) AuthServerConn(ctx context.Context, r *http.Request, protocol string) (*RTCConnContext, *RTCSignal, error) {
+	if corectx.Authenticator == nil {
+		return nil, nil, errors.New("authenticator is not set")
+	}
+
+	authStore, err := corectx.Authenticator.Authenticate(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// `mtc-store` may be shared by other requests
+	store, _ := ctx.Value("mtc-store").(map[string]string)
+	if store = maps.Clone(store); store == nil {
+		store = make(map[string]string, len(authStore))
+	}
+	maps.Copy(store, authStore)
+
+	if store["node_id"] == "" || store["conn_type"] == "" {
+		return nil, nil, &mtcws.AuthError{Status: http.StatusUnauthorized, Message: "invalid node-id or conn-type"}
+	}
+
+	conn, responseSignal := corectx.InitServerConn(context.WithValue(ctx, "mtc-store", store), store["node_id"], store["conn_type"], protocol)
+	return conn, responseSignal, nil
+}
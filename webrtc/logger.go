@@ -3,39 +3,83 @@ package mtcrtc
 import (
 	"fmt"
 	"log/slog"
+	"net"
+	"strconv"
 
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
 	"github.com/pion/logging"
 )
 
 // ref https://github.com/pion/webrtc/blob/master/examples/custom-logger/main.go
 
 type slogLogger struct {
+	logger    *slog.Logger
 	subsystem string
 }
 
-func (l slogLogger) Trace(msg string) { slog.Debug(msg, "subsystem", l.subsystem, "level", "trace") }
+func (l slogLogger) Trace(msg string) {
+	l.logger.Debug(msg, "subsystem", l.subsystem, "level", "trace")
+}
 func (l slogLogger) Tracef(format string, args ...any) {
-	slog.Debug(fmt.Sprintf(format, args...), "subsystem", l.subsystem, "level", "trace")
+	l.logger.Debug(fmt.Sprintf(format, args...), "subsystem", l.subsystem, "level", "trace")
 }
-func (l slogLogger) Debug(msg string) { slog.Debug(msg, "subsystem", l.subsystem) }
+func (l slogLogger) Debug(msg string) { l.logger.Debug(msg, "subsystem", l.subsystem) }
 func (l slogLogger) Debugf(format string, args ...any) {
-	slog.Debug(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
+	l.logger.Debug(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
 }
-func (l slogLogger) Info(msg string) { slog.Info(msg, "subsystem", l.subsystem) }
+func (l slogLogger) Info(msg string) { l.logger.Info(msg, "subsystem", l.subsystem) }
 func (l slogLogger) Infof(format string, args ...any) {
-	slog.Info(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
+	l.logger.Info(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
 }
-func (l slogLogger) Warn(msg string) { slog.Warn(msg, "subsystem", l.subsystem) }
+func (l slogLogger) Warn(msg string) { l.logger.Warn(msg, "subsystem", l.subsystem) }
 func (l slogLogger) Warnf(format string, args ...any) {
-	slog.Warn(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
+	l.logger.Warn(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
 }
-func (l slogLogger) Error(msg string) { slog.Error(msg, "subsystem", l.subsystem) }
+func (l slogLogger) Error(msg string) { l.logger.Error(msg, "subsystem", l.subsystem) }
 func (l slogLogger) Errorf(format string, args ...any) {
-	slog.Error(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
+	l.logger.Error(fmt.Sprintf(format, args...), "subsystem", l.subsystem)
 }
 
-type slogLoggerFactory struct{}
+// slogLoggerFactory pion records go to the logger of the connection
+type slogLoggerFactory struct {
+	logger *slog.Logger
+}
 
 func (f slogLoggerFactory) NewLogger(subsystem string) logging.LeveledLogger {
-	return slogLogger{subsystem: subsystem}
+	return slogLogger{logger: f.logger, subsystem: subsystem}
+}
+
+// logger `Logger` or `slog.Default()`, with `module=mtcrtc`
+func (corectx *RTCCoreCtx) logger() *slog.Logger {
+	if corectx.log != nil {
+		return corectx.log
+	}
+	return mtcws.NewModuleLogger(corectx.Logger, "mtcrtc")
+}
+
+// initLogger the logger of the connection, `conn_id`, `conn_type` and `protocol` are set on each record.
+// The remote address is known once ICE selected a candidate pair, it's logged by `connected` and `disconnected`
+func (rtcconn *RTCConnContext) initLogger() {
+	rtcconn.Logger = rtcconn.Ext.logger().With(
+		"conn_id", rtcconn.ConnKey(),
+		"conn_type", rtcconn.ConnType,
+		"protocol", rtcconn.Protocol,
+	)
+}
+
+// RemoteAddr `address:port` of the selected ICE candidate pair, empty before connected
+func (rtcconn *RTCConnContext) RemoteAddr() string {
+	if rtcconn.Peer == nil {
+		return ""
+	}
+	sctp := rtcconn.Peer.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return ""
+	}
+
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil || pair.Remote == nil {
+		return ""
+	}
+	return net.JoinHostPort(pair.Remote.Address, strconv.Itoa(int(pair.Remote.Port)))
 }
@@ -0,0 +1,90 @@
+package mtcrtc
+
+import (
+	"time"
+
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+)
+
+type rtcMetrics struct {
+	connections       mtcmetrics.Gauge
+	dataChannels      mtcmetrics.Gauge
+	messagesReceived  mtcmetrics.Counter
+	messagesSent      mtcmetrics.Counter
+	bytesReceived     mtcmetrics.Counter
+	bytesSent         mtcmetrics.Counter
+	broadcastFailures mtcmetrics.Counter
+	disconnects       mtcmetrics.Counter
+	lifetime          mtcmetrics.Histogram
+}
+
+func newRTCMetrics(registry mtcmetrics.Registry) *rtcMetrics {
+	return &rtcMetrics{
+		connections:       registry.Gauge("mtc_rtc_connections", "Connected webrtc peers.", "conn_type"),
+		dataChannels:      registry.Gauge("mtc_rtc_data_channels", "Open webrtc data channels.", "conn_type"),
+		messagesReceived:  registry.Counter("mtc_rtc_messages_received_total", "Webrtc data channel messages received.", "conn_type"),
+		messagesSent:      registry.Counter("mtc_rtc_messages_sent_total", "Webrtc data channel messages sent.", "conn_type"),
+		bytesReceived:     registry.Counter("mtc_rtc_received_bytes_total", "Webrtc data channel bytes received.", "conn_type"),
+		bytesSent:         registry.Counter("mtc_rtc_sent_bytes_total", "Webrtc data channel bytes sent.", "conn_type"),
+		broadcastFailures: registry.Counter("mtc_rtc_broadcast_failures_total", "Failed sends of broadcasts.", "conn_type"),
+		disconnects:       registry.Counter("mtc_rtc_disconnects_total", "Closed webrtc connections by disconnect_reason.", "conn_type", "reason"),
+		lifetime:          registry.Histogram("mtc_rtc_connection_duration_seconds", "Lifetime of closed webrtc connections.", mtcmetrics.LifetimeBuckets, "conn_type"),
+	}
+}
+
+// the methods are no-op on nil, i.e. `Metrics` is not set
+
+// connected once per connection on the first connected state
+func (m *rtcMetrics) connected(rtcconn *RTCConnContext) {
+	if m != nil {
+		m.connections.Add(1, rtcconn.ConnType)
+	}
+}
+
+// closed peers which never connected are only counted in `mtc_rtc_disconnects_total`
+func (m *rtcMetrics) closed(rtcconn *RTCConnContext, reason string) {
+	if m == nil {
+		return
+	}
+	if reason == "" {
+		reason = "none"
+	}
+
+	if rtcconn.connected.Load() {
+		m.connections.Add(-1, rtcconn.ConnType)
+		m.lifetime.Observe(time.Since(rtcconn.ConnectedAt).Seconds(), rtcconn.ConnType)
+	}
+	m.disconnects.Add(1, rtcconn.ConnType, reason)
+}
+
+func (m *rtcMetrics) channelOpened(rtcconn *RTCConnContext) {
+	if m != nil {
+		m.dataChannels.Add(1, rtcconn.ConnType)
+	}
+}
+
+func (m *rtcMetrics) channelClosed(rtcconn *RTCConnContext) {
+	if m != nil {
+		m.dataChannels.Add(-1, rtcconn.ConnType)
+	}
+}
+
+func (m *rtcMetrics) received(rtcconn *RTCConnContext, size int) {
+	if m != nil {
+		m.messagesReceived.Add(1, rtcconn.ConnType)
+		m.bytesReceived.Add(float64(size), rtcconn.ConnType)
+	}
+}
+
+func (m *rtcMetrics) sent(rtcconn *RTCConnContext, size int) {
+	if m != nil {
+		m.messagesSent.Add(1, rtcconn.ConnType)
+		m.bytesSent.Add(float64(size), rtcconn.ConnType)
+	}
+}
+
+func (m *rtcMetrics) broadcastFailed(rtcconn *RTCConnContext) {
+	if m != nil {
+		m.broadcastFailures.Add(1, rtcconn.ConnType)
+	}
+}
@@ -0,0 +1,91 @@
+package mtcrtc
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/jellydator/ttlcache/v3"
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
+)
+
+// GetConn get the connection of a node, nil if it is not connected
+func (corectx *RTCCoreCtx) GetConn(connType, nodeID string) *RTCConnContext {
+	if item := corectx.WebRTCConnPool.Get(connType + ":" + nodeID); item != nil {
+		return item.Value()
+	}
+	return nil
+}
+
+// Sessions the open connection of a node, a node has at most one
+func (corectx *RTCCoreCtx) Sessions(connType, nodeID string) []*RTCConnContext {
+	if conn := corectx.GetConn(connType, nodeID); conn != nil && conn.Ctx.Err() == nil {
+		return []*RTCConnContext{conn}
+	}
+	return nil
+}
+
+func (corectx *RTCCoreCtx) IsOnline(connType, nodeID string) bool {
+	return len(corectx.Sessions(connType, nodeID)) > 0
+}
+
+// SendToNode send data to the connection of a node, errors are keyed by `ConnKey()`, `mtcws.ErrNodeOffline` if it is not connected
+func (corectx *RTCCoreCtx) SendToNode(connType, nodeID string, data []byte) (map[string]error, error) {
+	sessions := corectx.Sessions(connType, nodeID)
+	if len(sessions) == 0 {
+		return nil, mtcws.ErrNodeOffline
+	}
+
+	errs := make(map[string]error, len(sessions))
+	for _, conn := range sessions {
+		errs[conn.ConnKey()] = conn.SendRTCMessage(data)
+	}
+
+	return errs, nil
+}
+
+// SendToNodes send data to the connections of the nodes, errors are keyed by `ConnKey()`,
+// offline nodes get `mtcws.ErrNodeOffline` keyed by `conn_type:node_id`
+func (corectx *RTCCoreCtx) SendToNodes(connType string, nodeIDs []string, data []byte) map[string]error {
+	errs := make(map[string]error)
+	for _, nodeID := range nodeIDs {
+		nodeErrs, err := corectx.SendToNode(connType, nodeID, data)
+		if err != nil {
+			errs[connType+":"+nodeID] = err
+			continue
+		}
+		maps.Copy(errs, nodeErrs)
+	}
+
+	return errs
+}
+
+// ListConns list connections ordered by `ConnectedAt`, limit <= 0 means no limit, returns the page and the total count
+func (corectx *RTCCoreCtx) ListConns(offset, limit int) ([]*RTCConnContext, int) {
+	conns := corectx.SelectConns(nil)
+	total := len(conns)
+
+	offset = min(max(offset, 0), total)
+	if limit <= 0 || offset+limit > total {
+		limit = total - offset
+	}
+
+	return conns[offset : offset+limit], total
+}
+
+// SelectConns connections whose `Store` matches, nil selects all, ordered by `ConnectedAt`
+func (corectx *RTCCoreCtx) SelectConns(match func(store map[string]string) bool) []*RTCConnContext {
+	conns := []*RTCConnContext{}
+	corectx.WebRTCConnPool.Range(func(item *ttlcache.Item[string, *RTCConnContext]) bool {
+		if conn := item.Value(); conn != nil && (match == nil || conn.matchStore(match)) {
+			conns = append(conns, conn)
+		}
+		return true
+	})
+
+	slices.SortFunc(conns, func(a, b *RTCConnContext) int {
+		return cmp.Or(a.ConnectedAt.Compare(b.ConnectedAt), cmp.Compare(a.ConnKey(), b.ConnKey()))
+	})
+
+	return conns
+}
@@ -1,10 +1,12 @@
 package mtcrtc
 
 import (
+	"context"
 	"errors"
-	"log/slog"
 
 	"github.com/jellydator/ttlcache/v3"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -17,19 +19,42 @@ func (rtcconn *RTCConnContext) SendRTCMessage(data []byte) error {
 		return err
 	}
 
-	return rtcconn.MainChannel.Send(data)
+	if err := rtcconn.MainChannel.Send(data); err != nil {
+		return err
+	}
+
+	rtcconn.Ext.metrics.sent(rtcconn, len(data))
+	return nil
 }
 
 func (corectx *RTCCoreCtx) BroadcastToRTC(data []byte, connTypeFilter string) {
+	corectx.BroadcastToRTCContext(context.Background(), data, connTypeFilter)
+}
+
+// BroadcastToRTCContext the broadcast span is a child of the span in ctx
+func (corectx *RTCCoreCtx) BroadcastToRTCContext(ctx context.Context, data []byte, connTypeFilter string) {
+	_, span := mtctrace.Start(corectx.Tracer, ctx, "mtcrtc.broadcast", mtctrace.String("mtc.conn_type_filter", connTypeFilter))
+
+	errs := make(map[string]error)
 	corectx.WebRTCConnPool.Range(func(item *ttlcache.Item[string, *RTCConnContext]) bool {
 		conn := item.Value()
 		if conn != nil {
 			if connTypeFilter != "" && conn.ConnType != connTypeFilter {
 				return true
 			}
-			slog.Debug("mtcrtc", item.Key(), data)
-			conn.SendRTCMessage(data)
+			mtcws.DebugSampled(conn.Logger, corectx.DebugSampler, "broadcast_payload", "size", len(data), "payload", data)
+			err := conn.SendRTCMessage(data)
+			if err != nil {
+				corectx.metrics.broadcastFailed(conn)
+			}
+			errs[item.Key()] = err
 		}
 		return true
 	})
+
+	mtcws.EndBroadcastSpan(span, errs)
+}
+
+func (corectx *RTCCoreCtx) PublishToTopic(topic string, data []byte) map[string]error {
+	return corectx.Topics.Publish(topic, data)
 }
@@ -0,0 +1,20 @@
+package mtcrtc
+
+import (
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+)
+
+// RPCSession the session of rpc messages from the connection, `ID` is `ConnKey()` and `Store` a copy of the store
+func (rtcconn *RTCConnContext) RPCSession() *mocarpc.MocaRPCSession {
+	return &mocarpc.MocaRPCSession{
+		ID:    rtcconn.ConnKey(),
+		Store: rtcconn.CloneStore(),
+	}
+}
+
+// closeRPC stop the peer, pending calls are canceled and the rate limit buckets of the connection are released
+func (rtcconn *RTCConnContext) closeRPC() {
+	if rtcconn.RPC != nil {
+		rtcconn.RPC.Close()
+	}
+}
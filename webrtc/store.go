@@ -0,0 +1,63 @@
+package mtcrtc
+
+import (
+	"maps"
+)
+
+// `Store` is owned by the connection after `InitConnCtx()` and written by signaling, the heartbeat and the close paths,
+// use these helpers instead of the map while the connection is served
+
+// GetStore a value of `Store`
+func (rtcconn *RTCConnContext) GetStore(key string) string {
+	rtcconn.storeMu.RLock()
+	defer rtcconn.storeMu.RUnlock()
+
+	return rtcconn.Store[key]
+}
+
+// SetStore a value of `Store`
+func (rtcconn *RTCConnContext) SetStore(key, value string) {
+	rtcconn.storeMu.Lock()
+	defer rtcconn.storeMu.Unlock()
+
+	if rtcconn.Store == nil {
+		rtcconn.Store = make(map[string]string)
+	}
+	rtcconn.Store[key] = value
+}
+
+// CloneStore a copy of `Store`
+func (rtcconn *RTCConnContext) CloneStore() map[string]string {
+	rtcconn.storeMu.RLock()
+	defer rtcconn.storeMu.RUnlock()
+
+	return maps.Clone(rtcconn.Store)
+}
+
+// DisconnectReason `disconnect_reason` of the store, empty until the connection is closing
+func (rtcconn *RTCConnContext) DisconnectReason() string {
+	return rtcconn.GetStore("disconnect_reason")
+}
+
+// setStoreIfEmpty returns false if the key has a value already, e.g. the first `disconnect_reason` wins
+func (rtcconn *RTCConnContext) setStoreIfEmpty(key, value string) bool {
+	rtcconn.storeMu.Lock()
+	defer rtcconn.storeMu.Unlock()
+
+	if rtcconn.Store[key] != "" {
+		return false
+	}
+	if rtcconn.Store == nil {
+		rtcconn.Store = make(map[string]string)
+	}
+	rtcconn.Store[key] = value
+	return true
+}
+
+// matchStore call match under the read lock
+func (rtcconn *RTCConnContext) matchStore(match func(store map[string]string) bool) bool {
+	rtcconn.storeMu.RLock()
+	defer rtcconn.storeMu.RUnlock()
+
+	return match(rtcconn.Store)
+}
@@ -0,0 +1,34 @@
+package mtcrtc
+
+import (
+	"context"
+	"strconv"
+
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcws "github.com/kdnetwork/message-transfer-core/websocket"
+)
+
+// startConnSpan `mtcrtc.connection`, ended in `Close()`
+func (rtcconn *RTCConnContext) startConnSpan(ctx context.Context) {
+	_, rtcconn.span = mtctrace.Start(rtcconn.Ext.Tracer, ctx, "mtcrtc.connection", mtcws.ConnAttrs(rtcconn.ConnKey(), rtcconn.ConnType, rtcconn.Protocol)...)
+}
+
+func (rtcconn *RTCConnContext) endConnSpan() {
+	if rtcconn.span == nil {
+		return
+	}
+
+	rtcconn.span.SetAttr("mtc.disconnect_reason", rtcconn.DisconnectReason())
+	rtcconn.span.End()
+}
+
+// startMessageSpan `mtcrtc.message`, a root span per data channel message
+func (rtcconn *RTCConnContext) startMessageSpan(label string, size int) mtctrace.Span {
+	attrs := append(mtcws.ConnAttrs(rtcconn.ConnKey(), rtcconn.ConnType, rtcconn.Protocol),
+		mtctrace.String("mtc.channel", label),
+		mtctrace.String("mtc.size", strconv.Itoa(size)),
+	)
+
+	_, span := mtctrace.Start(rtcconn.Ext.Tracer, context.Background(), "mtcrtc.message", attrs...)
+	return span
+}
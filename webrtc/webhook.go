@@ -0,0 +1,21 @@
+package mtcrtc
+
+import (
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
+)
+
+// dispatchWebhook queue a lifecycle event of the connection, the reason of disconnections is `disconnect_reason`
+func (rtcconn *RTCConnContext) dispatchWebhook(eventType string) {
+	if rtcconn.Ext.Webhooks == nil {
+		return
+	}
+
+	event := mtcwebhook.NewEvent(eventType, "rtc", rtcconn.ConnKey(), rtcconn.ID, rtcconn.ConnType, rtcconn.ConnectedAt)
+	if eventType != mtcwebhook.EventConnected {
+		event.Reason = rtcconn.DisconnectReason()
+	}
+
+	if err := rtcconn.Ext.Webhooks.Dispatch(event); err != nil {
+		rtcconn.Logger.Warn("webhook_dropped", "event", eventType, "error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package mtcws
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Authenticator verifies the upgrade request and returns the `Store` of the connection,
+// `node_id` and `conn_type` are required. With `Anonymous` set, a request failing with `ErrMissingToken`
+// is accepted as anonymous, other errors are still rejected. Errors other than `*AuthError` are rejected with 401
+type Authenticator interface {
+	Authenticate(r *http.Request) (map[string]string, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (map[string]string, error)
+
+func (fn AuthenticatorFunc) Authenticate(r *http.Request) (map[string]string, error) {
+	return fn(r)
+}
+
+// AuthError rejects the upgrade with `Status`
+type AuthError struct {
+	Status  int
+	Message string
+}
+
+func (err *AuthError) Error() string {
+	return err.Message
+}
+
+var ErrMissingToken = &AuthError{Status: http.StatusUnauthorized, Message: "missing token"}
+
+// AuthErrorStatus the http status of an authenticator error
+func AuthErrorStatus(err error) int {
+	var authErr *AuthError
+	if errors.As(err, &authErr) && authErr.Status > 0 {
+		return authErr.Status
+	}
+	return http.StatusUnauthorized
+}
+
+const (
+	TokenQueryKey       = "token"
+	TokenCookieName     = "mtc_token"
+	TokenProtocolPrefix = "token." // `Sec-WebSocket-Protocol: json, token.<token>` for browsers which can't set headers
+)
+
+// RequestToken the token of the upgrade request from `Authorization: Bearer`, `?token=`,
+// the `mtc_token` cookie or the `Sec-WebSocket-Protocol` entry, in this order
+func RequestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return token
+	}
+
+	if token := r.URL.Query().Get(TokenQueryKey); token != "" {
+		return token
+	}
+
+	if cookie, err := r.Cookie(TokenCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for protocol := range strings.SplitSeq(header, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), TokenProtocolPrefix); ok && token != "" {
+				return token
+			}
+		}
+	}
+
+	return ""
+}
+
+// TokenAuthenticator verifies the token from `RequestToken()`
+func TokenAuthenticator(verify func(token string) (map[string]string, error)) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (map[string]string, error) {
+		token := RequestToken(r)
+		if token == "" {
+			return nil, ErrMissingToken
+		}
+		return verify(token)
+	})
+}
@@ -0,0 +1,195 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginPolicy(t *testing.T) {
+	policy, err := NewOriginPolicy(false, "https://example.com", "*.example.net", "https://*.example.org:8443", `regex:^https://app-\d+\.example\.io$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for origin, want := range map[string]bool{
+		"":                             false,
+		"https://example.com":          true,
+		"HTTPS://EXAMPLE.COM":          true,
+		"http://example.com":           false,
+		"https://evil.com":             false,
+		"https://example.com.evil.com": false,
+		"http://a.example.net":         true,
+		"https://a.b.example.net:444":  true,
+		"https://example.net":          false,
+		"https://a.example.org:8443":   true,
+		"https://a.example.org":        false,
+		"http://a.example.org:8443":    false,
+		"https://app-12.example.io":    true,
+		"https://app-x.example.io":     false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := policy.Check(r); got != want {
+			t.Errorf("origin %q allowed = %v, want %v", origin, got, want)
+		}
+	}
+
+	policy.AllowEmpty = true
+	if !policy.Check(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("request without origin rejected with `AllowEmpty`")
+	}
+
+	if _, err := NewOriginPolicy(false, "regex:("); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	for name, configure := range map[string]func(r *http.Request){
+		"header": func(r *http.Request) { r.Header.Set("Authorization", "Bearer t1") },
+		"query":  func(r *http.Request) { r.URL.RawQuery = TokenQueryKey + "=t1" },
+		"cookie": func(r *http.Request) { r.AddCookie(&http.Cookie{Name: TokenCookieName, Value: "t1"}) },
+		"protocol": func(r *http.Request) {
+			r.Header.Set("Sec-WebSocket-Protocol", "json, "+TokenProtocolPrefix+"t1")
+		},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		configure(r)
+		if token := RequestToken(r); token != "t1" {
+			t.Errorf("%s: token %q, want t1", name, token)
+		}
+	}
+
+	if token := RequestToken(httptest.NewRequest(http.MethodGet, "/", nil)); token != "" {
+		t.Errorf("token %q without credentials", token)
+	}
+}
+
+// testAuthenticator accepts the token `good` as node `verified`
+var testAuthenticator = TokenAuthenticator(func(token string) (map[string]string, error) {
+	if token != "good" {
+		return nil, &AuthError{Status: http.StatusForbidden, Message: "invalid token"}
+	}
+	return map[string]string{"node_id": "verified", "role": "admin"}, nil
+})
+
+func TestWebsocketServerRejects(t *testing.T) {
+	origins, _ := NewOriginPolicy(true, "https://example.com")
+
+	for _, test := range []struct {
+		name   string
+		core   *WsCoreCtx
+		header http.Header
+		status int
+	}{
+		{
+			name:   "bad_origin",
+			core:   &WsCoreCtx{OriginPolicy: origins},
+			header: http.Header{"Origin": {"https://evil.com"}},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "missing_token",
+			core:   &WsCoreCtx{Authenticator: testAuthenticator},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "bad_token",
+			core:   &WsCoreCtx{Authenticator: testAuthenticator},
+			header: http.Header{"Authorization": {"Bearer bad"}},
+			status: http.StatusForbidden,
+		},
+		{
+			// `Anonymous` only admits requests without a credential
+			name:   "anonymous_bad_token",
+			core:   &WsCoreCtx{Authenticator: testAuthenticator, Anonymous: true},
+			header: http.Header{"Authorization": {"Bearer bad"}},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "auth_without_identity",
+			core: &WsCoreCtx{Authenticator: AuthenticatorFunc(func(r *http.Request) (map[string]string, error) {
+				return map[string]string{"role": "admin"}, nil
+			})},
+			status: http.StatusUnauthorized,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, values := range test.header {
+				r.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+
+			if err := test.core.WebsocketServer(context.Background(), w, r); err == nil {
+				t.Fatal("request accepted")
+			}
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d", w.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestWebsocketServerAuthStore(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		anonymous bool
+		token     string
+		nodeID    string
+		connType  string
+		role      string
+	}{
+		// the verified identity overrides `mtc-store` and keeps its other entries
+		{name: "verified", token: "good", nodeID: "verified", connType: "user", role: "admin"},
+		{name: "anonymous_verified", anonymous: true, token: "good", nodeID: "verified", connType: "user", role: "admin"},
+		{name: "anonymous_missing_token", anonymous: true, connType: "anonymous"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			connected := make(chan *WsConnContext, 1)
+			core := &WsCoreCtx{Authenticator: testAuthenticator, Anonymous: test.anonymous}
+			core.OnConnected = func(conn *WsConnContext) error {
+				connected <- conn
+				return nil
+			}
+			server := newTestServer(t, core)
+			client := newTestClient(t, nil)
+
+			header := http.Header{}
+			if test.token != "" {
+				header.Set("Authorization", "Bearer "+test.token)
+			}
+			if _, err := client.WebsocketClient(context.Background(), testURL(server, "claimed"), header); err != nil {
+				t.Fatal(err)
+			}
+
+			conn := <-connected
+			if test.nodeID != "" && conn.ID != test.nodeID {
+				t.Errorf("node id %q, want %q", conn.ID, test.nodeID)
+			}
+			if test.nodeID == "" && conn.ID == "claimed" {
+				t.Error("anonymous connection kept the node id of `mtc-store`")
+			}
+			if conn.ConnType != test.connType {
+				t.Errorf("conn type %q, want %q", conn.ConnType, test.connType)
+			}
+			if role := conn.GetStore("role"); role != test.role {
+				t.Errorf("role %q, want %q", role, test.role)
+			}
+		})
+	}
+}
+
+func TestAuthErrorStatus(t *testing.T) {
+	if status := AuthErrorStatus(errors.New("denied")); status != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := AuthErrorStatus(&AuthError{Status: http.StatusForbidden}); status != http.StatusForbidden {
+		t.Errorf("status %d, want %d", status, http.StatusForbidden)
+	}
+}
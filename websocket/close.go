@@ -0,0 +1,103 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/lesismal/nbio/nbhttp/websocket"
+)
+
+const (
+	CloseCodeNormal          = 1000
+	CloseCodeGoingAway       = 1001
+	CloseCodePolicyViolation = 1008
+	CloseCodeInternalError   = 1011
+)
+
+// CloseCodes status codes of the close frame by `disconnect_reason`, unknown reasons use `CloseCodeNormal`
+var CloseCodes = map[string]int{
+	"shutdown":          CloseCodeGoingAway,
+	"policy_violation":  CloseCodePolicyViolation,
+	"session_rejected":  CloseCodePolicyViolation,
+	"kick":              4001,
+	"expired":           4002,
+	"heartbeat_timeout": 4003,
+	"slow_consumer":     4004,
+	"resumed":           4005,
+	"token_expired":     4006,
+}
+
+func CloseCode(reason string) int {
+	if code, ok := CloseCodes[reason]; ok {
+		return code
+	}
+	return CloseCodeNormal
+}
+
+// CloseWithReason disconnect with a close frame of the mapped status code and the reason text,
+// no-op if already closing, the first reason wins. Safe to call from any goroutine
+func (wsconn *WsConnContext) CloseWithReason(reason string) {
+	if wsconn.Ctx.Err() != nil {
+		return
+	}
+	wsconn.setStoreIfEmpty("disconnect_reason", reason)
+	wsconn.Cancel()
+}
+
+// writeClose the reason text is limited to 123 bytes by the protocol
+func (wsconn *WsConnContext) writeClose() error {
+	wsconn.storeMu.Lock()
+	reason := wsconn.Store["disconnect_reason"]
+	if reason == "" && errors.Is(wsconn.Ctx.Err(), context.DeadlineExceeded) {
+		reason = "expired"
+		wsconn.Store["disconnect_reason"] = reason
+	}
+	closeCode, hint := wsconn.Store["close_code"], wsconn.Store["reconnect_hint"]
+	wsconn.storeMu.Unlock()
+
+	// closed by the remote
+	if closeCode != "" {
+		return nil
+	}
+
+	text := reason
+	if hint != "" {
+		text += ";reconnect=" + hint
+	}
+	if len(text) > 123 {
+		text = text[:123]
+	}
+
+	return wsconn.Conn.WriteClose(CloseCode(reason), text)
+}
+
+// handleClose keep the status code and reason of the close frame from the remote,
+// the reason text is untrusted and only kept in `close_reason`, `disconnect_reason` is `remote_close`
+func (corectx *WsCoreCtx) handleClose(c *websocket.Conn, code int, text string) {
+	if wsConnContext := corectx.connSession(c); wsConnContext != nil {
+		wsConnContext.keepRemoteClose(code, text)
+	}
+
+	// echo the close frame
+	if code == 1005 {
+		_ = c.WriteMessage(websocket.CloseMessage, nil)
+		return
+	}
+	_ = c.WriteClose(code, text)
+}
+
+// keepRemoteClose record the close frame from the remote once, from `handleClose()` or `OnClose`
+func (wsconn *WsConnContext) keepRemoteClose(code int, text string) {
+	wsconn.storeMu.Lock()
+	defer wsconn.storeMu.Unlock()
+
+	if wsconn.Store["close_code"] != "" {
+		return
+	}
+	wsconn.Store["close_code"] = strconv.Itoa(code)
+	wsconn.Store["close_reason"] = text[:min(len(text), 123)]
+	if wsconn.Store["disconnect_reason"] == "" {
+		wsconn.Store["disconnect_reason"] = "remote_close"
+	}
+}
@@ -0,0 +1,56 @@
+package mtcws
+
+import (
+	"slices"
+
+	"github.com/lesismal/nbio/nbhttp/websocket"
+)
+
+// CompressionOptions permessage-deflate of the server and the client dialer.
+// nbio always negotiates `server_no_context_takeover; client_no_context_takeover`, every message is compressed on its own.
+// Context takeover is not configurable: both the upgrader and the dialer of nbio hardcode these parameters, and the dialer
+// rejects servers answering without them. Use `Threshold` to skip small messages that barely compress without a shared window
+type CompressionOptions struct {
+	Enabled           bool
+	Level             int      // `compress/flate` level, 0 uses the default of nbio (1, best speed)
+	Threshold         int      // messages smaller than this are sent uncompressed, 0 compresses all
+	DisabledProtocols []string // subprotocols sent uncompressed, e.g. `protobuf` which is already compact
+}
+
+func (corectx *WsCoreCtx) initCompression() {
+	if !corectx.Compression.Enabled {
+		return
+	}
+
+	corectx.WsUpgrader.EnableCompression(true)
+	if corectx.Compression.Level != 0 {
+		if err := corectx.WsUpgrader.SetCompressionLevel(corectx.Compression.Level); err != nil {
+			corectx.logger().Error("compression_level_invalid", "level", corectx.Compression.Level, "error", err)
+		}
+	}
+}
+
+// compressionAllowed whether messages of the connection may be compressed at all
+func (wsconn *WsConnContext) compressionAllowed() bool {
+	options := &wsconn.Ext.Compression
+	return options.Enabled && !slices.Contains(options.DisabledProtocols, wsconn.Protocol)
+}
+
+func (wsconn *WsConnContext) initCompression() {
+	if wsconn.Ext.Compression.Enabled && !wsconn.compressionAllowed() {
+		wsconn.Conn.EnableWriteCompression(false)
+	}
+}
+
+// writeMessage toggles write compression by `Threshold`, the flag of nbio is per connection so writes are serialized
+func (wsconn *WsConnContext) writeMessage(messageType websocket.MessageType, data []byte) error {
+	if wsconn.Ext.Compression.Threshold <= 0 || !wsconn.compressionAllowed() {
+		return wsconn.Conn.WriteMessage(messageType, data)
+	}
+
+	wsconn.writeMu.Lock()
+	defer wsconn.writeMu.Unlock()
+
+	wsconn.Conn.EnableWriteCompression(len(data) >= wsconn.Ext.Compression.Threshold)
+	return wsconn.Conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,184 @@
+package mtcws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lesismal/nbio/nbhttp/websocket"
+)
+
+// countingConn counts the bytes the server wrote to the client
+type countingConn struct {
+	net.Conn
+	read atomic.Int64
+}
+
+func (conn *countingConn) Read(p []byte) (int, error) {
+	n, err := conn.Conn.Read(p)
+	conn.read.Add(int64(n))
+	return n, err
+}
+
+// countingProxy relays the connections of the client to target, the server side of each is a `countingConn`
+func countingProxy(b *testing.B, target string) (string, chan *countingConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { listener.Close() })
+
+	upstreams := make(chan *countingConn, 1)
+	go func() {
+		for {
+			downstream, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn, err := net.Dial("tcp", target)
+			if err != nil {
+				downstream.Close()
+				continue
+			}
+			upstream := &countingConn{Conn: conn}
+			upstreams <- upstream
+
+			go func() {
+				io.Copy(upstream, downstream)
+				upstream.Close()
+			}()
+			go func() {
+				io.Copy(downstream, upstream)
+				downstream.Close()
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), upstreams
+}
+
+// benchmarkPayload a page of chat messages, ~250B of json per message
+func benchmarkPayload(count int) []byte {
+	type message struct {
+		ID        string            `json:"id"`
+		Room      string            `json:"room"`
+		Sender    string            `json:"sender"`
+		Text      string            `json:"text"`
+		Mentions  []string          `json:"mentions,omitempty"`
+		Reactions map[string]int    `json:"reactions,omitempty"`
+		Meta      map[string]string `json:"meta"`
+		SentAt    time.Time         `json:"sent_at"`
+	}
+
+	sentAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	messages := make([]*message, 0, count)
+	for i := range count {
+		messages = append(messages, &message{
+			ID:        fmt.Sprintf("01J%023d", i),
+			Room:      "room-" + fmt.Sprint(i%3),
+			Sender:    fmt.Sprintf("user-%04d", i*37%1000),
+			Text:      strings.Repeat(fmt.Sprintf("message %d of the page, ", i), 1+i%4),
+			Mentions:  []string{fmt.Sprintf("user-%04d", i*11%1000)},
+			Reactions: map[string]int{"+1": i % 5, "heart": i % 2},
+			Meta:      map[string]string{"client": "web", "version": "1.4.2"},
+			SentAt:    sentAt.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	payload, _ := json.Marshal(map[string]any{"type": "history", "messages": messages})
+	return payload
+}
+
+// benchmarkWrite sent-B is the size of a message on the wire, frame headers included
+func benchmarkWrite(b *testing.B, compression CompressionOptions, payload []byte) {
+	conns := make(chan *WsConnContext, 1)
+	server := &WsCoreCtx{Compression: compression}
+	server.OnConnected = func(conn *WsConnContext) error {
+		conns <- conn
+		return nil
+	}
+	server.Init()
+	server.InitUpgrader()
+	b.Cleanup(func() { server.Stop() })
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store := map[string]string{"node_id": "bench", "conn_type": "user"}
+		server.WebsocketServer(context.WithValue(context.Background(), "mtc-store", store), w, r)
+	}))
+	b.Cleanup(httpServer.Close)
+	proxyAddr, upstreams := countingProxy(b, httpServer.Listener.Addr().String())
+
+	var received atomic.Int64
+	client := &WsCoreCtxClient{}
+	client.Compression = compression
+	client.ConnectTimeout = time.Second * 3
+	client.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+		received.Add(1)
+		return nil, nil
+	}
+	client.Init()
+	client.InitUpgrader()
+	b.Cleanup(func() { client.Stop() })
+
+	if _, err := client.WebsocketClient(context.Background(), "ws://"+proxyAddr, http.Header{}); err != nil {
+		b.Fatal(err)
+	}
+	conn := <-conns
+	upstream := <-upstreams
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+
+	// the handshake is not counted
+	start := upstream.read.Load()
+	writes := int64(0)
+	for b.Loop() {
+		if err := conn.writeMessage(websocket.TextMessage, payload); err != nil {
+			b.Fatal(err)
+		}
+		writes++
+	}
+
+	deadline := time.Now().Add(time.Second * 10)
+	for received.Load() < writes {
+		if time.Now().After(deadline) {
+			b.Fatalf("%d of %d messages received", received.Load(), writes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.ReportMetric(float64(upstream.read.Load()-start)/float64(writes), "sent-B")
+}
+
+func BenchmarkCompressionWrite(b *testing.B) {
+	page, small := benchmarkPayload(32), benchmarkPayload(1)
+	const threshold = 1024
+
+	for _, bench := range []struct {
+		name        string
+		compression CompressionOptions
+		payload     []byte
+	}{
+		{name: "uncompressed", payload: page},
+		{name: "compressed", compression: CompressionOptions{Enabled: true}, payload: page},
+		{name: "compressed_best", compression: CompressionOptions{Enabled: true, Level: 9}, payload: page},
+		{name: "compressed_small", compression: CompressionOptions{Enabled: true}, payload: small},
+		// sent as is, below the threshold
+		{name: "threshold_below", compression: CompressionOptions{Enabled: true, Threshold: threshold}, payload: small},
+		{name: "threshold_above", compression: CompressionOptions{Enabled: true, Threshold: threshold}, payload: page},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			if bench.compression.Threshold > 0 && (len(bench.payload) >= threshold) != strings.HasSuffix(bench.name, "above") {
+				b.Fatalf("payload of %d bytes is on the wrong side of the threshold", len(bench.payload))
+			}
+			benchmarkWrite(b, bench.compression, bench.payload)
+		})
+	}
+}
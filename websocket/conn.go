@@ -1,84 +1,241 @@
 package mtcws
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"log/slog"
+	"maps"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jellydator/ttlcache/v3"
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
 	"github.com/lesismal/nbio/nbhttp/websocket"
 )
 
 type WsConnContext struct {
 	Conn        *websocket.Conn
 	ID          string
+	SessionID   string
 	ConnType    string
 	Protocol    string
 	Store       map[string]string
 	ConnectedAt time.Time
 
+	// set before `OnConnected` and `OnDisConnected`
+	FirstSession bool
+	LastSession  bool
+
+	// nil if `ResumeGracePeriod` is 0
+	Resume *ResumeSession
+
+	Heartbeat HeartbeatStats
+	Inbound   InboundStats
+
+	// nil if `SendQueueSize` is negative
+	SendQueue *SendQueue
+
+	// peer of `WsCoreCtx.RPC`, pass rpc messages to `RPC.ReadMessage()`, nil if disabled
+	RPC *mocarpc.MocaJsonRPCCtx
+
 	Ext *WsCoreCtx
 
+	// records of the connection, with `conn_id`, `conn_type`, `remote_addr` and `protocol`
+	Logger *slog.Logger
+
 	Ctx         context.Context
 	Cancel      context.CancelFunc
 	CloseAction sync.Once
+	Closed      chan struct{} // closed after `OnDisConnected` and the connection
+
+	span     mtctrace.Span
+	spanOnce sync.Once
+	writeMu  sync.Mutex
+	storeMu  sync.RWMutex
 }
 
 func (corectx *WsCoreCtx) InitConnCtx(_ctx context.Context, c *websocket.Conn, nodeID, connType string, protocol string, store map[string]string) (*WsConnContext, error) {
 	ctx, cancel := context.WithTimeout(_ctx, corectx.TTL)
-	connKey := connType + ":" + nodeID
 	connCtx := &WsConnContext{
 		Conn:        c,
 		ID:          nodeID,
+		SessionID:   uuid.NewString(),
 		ConnType:    connType,
 		Ext:         corectx,
 		Ctx:         ctx,
 		Cancel:      cancel,
 		Protocol:    AutoResponseProtocol(protocol),
-		Store:       store,
+		Store:       maps.Clone(store), // owned by the connection, `mtc-store` may be shared
 		ConnectedAt: time.Now(),
+		Closed:      make(chan struct{}),
+	}
+
+	if connCtx.Store == nil {
+		connCtx.Store = make(map[string]string)
+	}
+
+	connCtx.initLogger()
+	connCtx.Heartbeat.Seen()
+	connCtx.initCompression()
+	connCtx.startConnSpan(_ctx)
+
+	// read before `SetSession()`, the handlers of nbio may write `Store` after it
+	tokenExp, hasTokenExp := TokenExpiry(connCtx.Store)
+
+	if sendQueueSize := cmp.Or(corectx.SendQueueSize, DefaultSendQueueSize); sendQueueSize > 0 {
+		connCtx.SendQueue = NewSendQueue(sendQueueSize, corectx.SendQueuePolicy)
+		go connCtx.runSendQueue()
+	}
+
+	if corectx.RPC != nil {
+		connCtx.RPC = corectx.RPC.NewPeer(connCtx.RPCSession(), connCtx.SendWebsocketMessage)
+	}
+
+	// seq frames are json, other subprotocols are sent unwrapped
+	if corectx.ResumeSessions != nil && connCtx.Protocol == "json" {
+		connCtx.Resume = corectx.newResumeSession(connCtx)
 	}
 
 	c.SetSession(connCtx)
+	corectx.sessionReady(c)
 
-	_, err, shared := corectx.ConnSf.Do(connKey, func() (any, error) {
-		if item := corectx.WebsocketConnPool.Get(connKey); item != nil {
-			if existsConn := item.Value(); existsConn != nil && existsConn.Conn != nil {
-				existsConn.Store["disconnect_reason"] = "kick"
-				existsConn.Cancel()
-			}
+	// concurrent connections of a node are deduplicated unless multiple sessions are allowed
+	sfKey := connCtx.NodeKey()
+	if corectx.SessionPolicy == SessionPolicyMulti {
+		sfKey = connCtx.ConnKey()
+	}
+
+	// `Close()` owns the connection once the session is added,
+	// `shared` is also true for the caller running the function, only the others are duplicates
+	ran, added := false, false
+	_, err, shared := corectx.ConnSf.Do(sfKey, func() (any, error) {
+		ran = true
+		first, err := corectx.addSession(connCtx)
+		if err != nil {
+			return nil, err
 		}
-		corectx.WebsocketConnPool.Set(connKey, connCtx, ttlcache.DefaultTTL)
+		connCtx.FirstSession = first
+		added = true
+
+		corectx.WebsocketConnPool.Set(connCtx.ConnKey(), connCtx, ttlcache.DefaultTTL)
+		corectx.metrics.connected(connCtx)
+		connCtx.dispatchWebhook(mtcwebhook.EventConnected)
 		go connCtx.Close()
 
-		slog.Debug("mtcws", c.RemoteAddr().String(), "connected")
+		connCtx.Logger.Debug("connected")
+		if corectx.OnConnected == nil {
+			return nil, nil
+		}
 		return nil, corectx.OnConnected(connCtx)
 	})
 
+	if shared && !ran {
+		err = errors.New("duplicate connection")
+	}
 	if err != nil {
-		connCtx.Cancel()
+		connCtx.reject(added)
+		connCtx.endConnSpan(err)
 		return nil, err
-	} else if shared {
-		connCtx.Cancel()
-		return nil, errors.New("duplicate connection")
+	}
+
+	if corectx.HeartbeatInterval > 0 {
+		go connCtx.runHeartbeat()
+	}
+
+	if hasTokenExp {
+		go RunTokenExpiry(connCtx.Ctx, tokenExp, func() {
+			connCtx.CloseWithReason("token_expired")
+		})
+	}
+
+	if corectx.ReliableStore != nil {
+		go func() {
+			if err := connCtx.Redeliver(); err != nil {
+				connCtx.Logger.Error("redeliver_failed", "error", err)
+			}
+		}()
 	}
 
 	return connCtx, nil
 }
 
+// reject a connection failed in `InitConnCtx()` with a policy close frame
+func (wsconn *WsConnContext) reject(added bool) {
+	wsconn.CloseWithReason("session_rejected")
+
+	// not resumable, `detachResumeSession()` skips deleted tokens
+	if wsconn.Resume != nil {
+		wsconn.Ext.ResumeSessions.Delete(wsconn.Resume.Token)
+	}
+	if added {
+		return
+	}
+
+	wsconn.closeRPC()
+	if err := wsconn.writeClose(); err != nil {
+		wsconn.Logger.Debug("close_write_failed", "error", err)
+	}
+	wsconn.Conn.Close()
+}
+
+// NodeKey `conn_type:node_id`, shared by all sessions of the node
+func (wsconn *WsConnContext) NodeKey() string {
+	return wsconn.ConnType + ":" + wsconn.ID
+}
+
+// ConnKey `conn_type:node_id:session_id`, key of `WebsocketConnPool`
+func (wsconn *WsConnContext) ConnKey() string {
+	return wsconn.NodeKey() + ":" + wsconn.SessionID
+}
+
 func (wsconn *WsConnContext) Close() {
 	<-wsconn.Ctx.Done()
 	wsconn.CloseAction.Do(func() {
-		connID := wsconn.ConnType + ":" + wsconn.ID
+		connID := wsconn.ConnKey()
 
-		defer slog.Info("mtcws", "id", connID, "ip", wsconn.Conn.RemoteAddr().String(), "status", "closed")
+		defer func() {
+			wsconn.Logger.Info("disconnected", "reason", wsconn.DisconnectReason())
+		}()
+
+		wsconn.LastSession = wsconn.Ext.removeSession(wsconn)
 
 		if wsconn.Ext.OnDisConnected != nil {
 			wsconn.Ext.OnDisConnected(wsconn)
 		}
+		wsconn.closeRPC()
+
+		wsconn.Ext.Topics.LeaveAll(wsconn)
+		wsconn.Ext.WebsocketConnPool.Delete(connID)
+		wsconn.Ext.detachResumeSession(wsconn)
 
+		if err := wsconn.writeClose(); err != nil {
+			wsconn.Logger.Debug("close_write_failed", "error", err)
+		}
 		wsconn.Conn.Close()
+		reason := wsconn.DisconnectReason()
+		wsconn.Ext.metrics.closed(wsconn, reason)
+		wsconn.dispatchWebhook(mtcwebhook.DisconnectEvent(reason))
+		wsconn.endConnSpan(nil)
+		close(wsconn.Closed)
 	})
 }
+
+func (wsconn *WsConnContext) MemberKey() string {
+	return "ws:" + wsconn.ConnKey()
+}
+
+func (wsconn *WsConnContext) Send(data []byte) error {
+	return wsconn.SendWebsocketMessage(data)
+}
+
+func (wsconn *WsConnContext) JoinTopic(topic string) {
+	wsconn.Ext.Topics.Join(topic, wsconn)
+}
+
+func (wsconn *WsConnContext) LeaveTopic(topic string) {
+	wsconn.Ext.Topics.Leave(topic, wsconn)
+}
@@ -55,6 +55,7 @@ func (wsconn *WsCoreCtxClient) WebsocketClient(ctx context.Context, _url string,
 	c, _, err := dialer.Dial(_url, headers)
 	if err != nil {
 		if c != nil {
+			wsconn.sessionReady(c)
 			return nil, c.Close()
 		}
 		return nil, err
@@ -0,0 +1,220 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	ClientStateConnecting   = "connecting"
+	ClientStateConnected    = "connected"
+	ClientStateDisconnected = "disconnected" // waiting for the next retry
+	ClientStateStopped      = "stopped"
+)
+
+const (
+	ClientSendPolicyReject = "reject" // default, `Send` fails while disconnected
+	ClientSendPolicyQueue  = "queue"  // up to `QueueSize` messages are sent after reconnecting
+)
+
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// ManagedClientConn a client connection that redials with exponential backoff and jitter until closed or `WsCoreCtxClient.Stop()`
+type ManagedClientConn struct {
+	URL     string
+	Headers http.Header
+	Store   map[string]string // `mtc-store` of the first dial, cloned for each dial
+
+	MinBackoff time.Duration // 500ms by default
+	MaxBackoff time.Duration // 30s by default
+	SendPolicy string
+	QueueSize  int // 100 by default
+
+	OnStateChange func(conn *ManagedClientConn, state string, err error)
+
+	Ext    *WsCoreCtxClient
+	Ctx    context.Context
+	Cancel context.CancelFunc // stop reconnecting and close the connection
+
+	conn  *WsConnContext
+	state string
+	queue [][]byte
+
+	mu     sync.Mutex
+	sendMu sync.Mutex // keeps `Send()` behind the flush of the queue
+}
+
+// ManagedClient dial in background, set the callbacks and options before calling `Start()`
+func (wsconn *WsCoreCtxClient) ManagedClient(ctx context.Context, _url string, headers http.Header) *ManagedClientConn {
+	store, _ := ctx.Value("mtc-store").(map[string]string)
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &ManagedClientConn{
+		URL:     _url,
+		Headers: headers,
+		Store:   store,
+
+		Ext:    wsconn,
+		Ctx:    ctx,
+		Cancel: cancel,
+		state:  ClientStateDisconnected,
+	}
+}
+
+func (managed *ManagedClientConn) Start() {
+	if managed.MinBackoff <= 0 {
+		managed.MinBackoff = time.Millisecond * 500
+	}
+	if managed.MaxBackoff < managed.MinBackoff {
+		managed.MaxBackoff = max(time.Second*30, managed.MinBackoff)
+	}
+	if managed.QueueSize <= 0 {
+		managed.QueueSize = 100
+	}
+
+	go managed.run()
+}
+
+func (managed *ManagedClientConn) State() string {
+	managed.mu.Lock()
+	defer managed.mu.Unlock()
+
+	return managed.state
+}
+
+// Conn the current connection, nil while disconnected
+func (managed *ManagedClientConn) Conn() *WsConnContext {
+	managed.mu.Lock()
+	defer managed.mu.Unlock()
+
+	return managed.conn
+}
+
+func (managed *ManagedClientConn) setState(state string, conn *WsConnContext, err error) {
+	managed.mu.Lock()
+	managed.state = state
+	managed.conn = conn
+	managed.mu.Unlock()
+
+	managed.Ext.logger().Debug("client_state_changed", "url", managed.URL, "state", state, "error", err)
+	if managed.OnStateChange != nil {
+		managed.OnStateChange(managed, state, err)
+	}
+}
+
+func (managed *ManagedClientConn) run() {
+	defer managed.setState(ClientStateStopped, nil, nil)
+
+	for attempt := 0; ; {
+		managed.setState(ClientStateConnecting, nil, nil)
+
+		conn, err := managed.dial()
+		if err == nil {
+			attempt = 0
+			managed.setState(ClientStateConnected, conn, nil)
+			managed.flush(conn)
+
+			select {
+			case <-conn.Ctx.Done():
+				var reason error
+				if closeReason, disconnectReason := conn.GetStore("close_reason"), conn.DisconnectReason(); closeReason != "" {
+					reason = errors.New(disconnectReason + ": " + closeReason)
+				} else if disconnectReason != "" {
+					reason = errors.New(disconnectReason)
+				}
+				managed.setState(ClientStateDisconnected, nil, reason)
+			case <-managed.Ctx.Done():
+				conn.Cancel()
+				return
+			case <-managed.Ext.Ctx.Done():
+				conn.Cancel()
+				return
+			}
+		} else {
+			managed.setState(ClientStateDisconnected, nil, err)
+		}
+
+		select {
+		case <-time.After(managed.backoff(attempt)):
+			attempt++
+		case <-managed.Ctx.Done():
+			return
+		case <-managed.Ext.Ctx.Done():
+			return
+		}
+	}
+}
+
+func (managed *ManagedClientConn) dial() (*WsConnContext, error) {
+	ctx := managed.Ctx
+	if managed.Store != nil {
+		ctx = context.WithValue(ctx, "mtc-store", maps.Clone(managed.Store))
+	}
+
+	return managed.Ext.WebsocketClient(ctx, managed.URL, managed.Headers.Clone())
+}
+
+// backoff min * 2^attempt up to max, with jitter in [d/2, d]
+func (managed *ManagedClientConn) backoff(attempt int) time.Duration {
+	d := managed.MaxBackoff
+	if attempt < 32 {
+		d = min(managed.MinBackoff<<attempt, managed.MaxBackoff)
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+func (managed *ManagedClientConn) flush(conn *WsConnContext) {
+	managed.sendMu.Lock()
+	defer managed.sendMu.Unlock()
+
+	managed.mu.Lock()
+	queue := managed.queue
+	managed.queue = nil
+	managed.mu.Unlock()
+
+	for i, data := range queue {
+		if err := conn.SendWebsocketMessage(data); err != nil {
+			// keep the rest for the next connection
+			managed.mu.Lock()
+			managed.queue = append(queue[i:], managed.queue...)
+			managed.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Send in order, messages queued while disconnected are sent first
+func (managed *ManagedClientConn) Send(data []byte) error {
+	managed.sendMu.Lock()
+	defer managed.sendMu.Unlock()
+
+	managed.mu.Lock()
+	conn, queued := managed.conn, len(managed.queue) > 0
+	managed.mu.Unlock()
+
+	if conn != nil && (!queued || managed.SendPolicy != ClientSendPolicyQueue) {
+		if err := conn.SendWebsocketMessage(data); err == nil || managed.SendPolicy != ClientSendPolicyQueue {
+			return err
+		}
+	}
+
+	if managed.SendPolicy != ClientSendPolicyQueue {
+		return ErrClientDisconnected
+	}
+
+	managed.mu.Lock()
+	defer managed.mu.Unlock()
+
+	if len(managed.queue) >= managed.QueueSize {
+		return errors.New("client send queue is full")
+	}
+	managed.queue = append(managed.queue, data)
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestManagedClientBackoff(t *testing.T) {
+	managed := &ManagedClientConn{MinBackoff: time.Millisecond * 100, MaxBackoff: time.Second * 5}
+
+	for attempt := range 40 {
+		want := managed.MaxBackoff
+		if attempt < 32 {
+			want = min(managed.MinBackoff<<attempt, managed.MaxBackoff)
+		}
+		for range 100 {
+			if d := managed.backoff(attempt); d < want/2 || d > want {
+				t.Fatalf("backoff of attempt %d is %v, want [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+// managedTestServer messages received by the server and its connections
+func managedTestServer(t *testing.T) (string, chan string, chan *WsConnContext) {
+	received := make(chan string, 100)
+	connected := make(chan *WsConnContext, 10)
+	core := &WsCoreCtx{}
+	core.OnConnected = func(conn *WsConnContext) error {
+		connected <- conn
+		return nil
+	}
+	core.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+		received <- string(message)
+		return nil, nil
+	}
+	return testURL(newTestServer(t, core), "u1"), received, connected
+}
+
+func expectMessages(t *testing.T, received chan string, want ...string) {
+	t.Helper()
+
+	for _, message := range want {
+		select {
+		case got := <-received:
+			if got != message {
+				t.Fatalf("received %s, want %s", got, message)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("%s not received", message)
+		}
+	}
+}
+
+func TestManagedClientSendPolicies(t *testing.T) {
+	t.Run(ClientSendPolicyReject, func(t *testing.T) {
+		url, received, _ := managedTestServer(t)
+		managed := newTestClient(t, nil).ManagedClient(context.Background(), url, http.Header{})
+
+		if err := managed.Send([]byte(`"m1"`)); !errors.Is(err, ErrClientDisconnected) {
+			t.Fatalf("Send while disconnected returned %v, want %v", err, ErrClientDisconnected)
+		}
+
+		managed.Start()
+		defer managed.Cancel()
+		if managed.MinBackoff != time.Millisecond*500 || managed.MaxBackoff != time.Second*30 || managed.QueueSize != 100 {
+			t.Errorf("backoff [%v, %v] queue size %d, want the defaults", managed.MinBackoff, managed.MaxBackoff, managed.QueueSize)
+		}
+		waitFor(t, "the connection", func() bool { return managed.State() == ClientStateConnected })
+
+		if err := managed.Send([]byte(`"m2"`)); err != nil {
+			t.Fatal(err)
+		}
+		expectMessages(t, received, `"m2"`)
+	})
+
+	t.Run(ClientSendPolicyQueue, func(t *testing.T) {
+		url, received, _ := managedTestServer(t)
+		managed := newTestClient(t, nil).ManagedClient(context.Background(), url, http.Header{})
+		managed.SendPolicy = ClientSendPolicyQueue
+		managed.QueueSize = 2
+
+		for _, message := range []string{`"m1"`, `"m2"`} {
+			if err := managed.Send([]byte(message)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := managed.Send([]byte(`"m3"`)); err == nil {
+			t.Fatal("Send to a full queue succeeded")
+		}
+
+		// the queue is flushed first, in order
+		managed.Start()
+		defer managed.Cancel()
+		waitFor(t, "the connection", func() bool { return managed.State() == ClientStateConnected })
+		if err := managed.Send([]byte(`"m4"`)); err != nil {
+			t.Fatal(err)
+		}
+		expectMessages(t, received, `"m1"`, `"m2"`, `"m4"`)
+	})
+}
+
+func TestManagedClientReconnect(t *testing.T) {
+	url, received, connected := managedTestServer(t)
+
+	states := make(chan string, 100)
+	managed := newTestClient(t, nil).ManagedClient(context.Background(), url, http.Header{})
+	managed.MinBackoff = time.Millisecond * 10
+	managed.MaxBackoff = time.Millisecond * 20
+	managed.OnStateChange = func(conn *ManagedClientConn, state string, err error) {
+		states <- state
+	}
+	managed.Start()
+
+	first := <-connected
+	waitFor(t, "the connection", func() bool { return managed.State() == ClientStateConnected })
+	first.CloseWithReason("kick")
+
+	second := <-connected
+	if second.SessionID == first.SessionID {
+		t.Fatal("the closed session was not replaced")
+	}
+	waitFor(t, "the reconnection", func() bool {
+		conn := managed.Conn()
+		return conn != nil && conn.Ctx.Err() == nil
+	})
+	if err := managed.Send([]byte(`"m1"`)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, received, `"m1"`)
+
+	managed.Cancel()
+	waitFor(t, "the stop", func() bool { return managed.State() == ClientStateStopped })
+	waitClosed(t, second)
+
+	want := []string{ClientStateConnecting, ClientStateConnected, ClientStateDisconnected, ClientStateConnecting, ClientStateConnected, ClientStateStopped}
+	for _, state := range want {
+		if got := <-states; got != state {
+			t.Fatalf("state %s, want %s", got, state)
+		}
+	}
+}
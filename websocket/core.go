@@ -5,9 +5,15 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jellydator/ttlcache/v3"
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
 	"github.com/lesismal/nbio/nbhttp/websocket"
 	"golang.org/x/sync/singleflight"
 )
@@ -20,27 +26,100 @@ type WsCoreCtx struct {
 	TTL            time.Duration
 	ConnectTimeout time.Duration
 	ConnSize       uint64
+	SessionPolicy  string // `SessionPolicyKickOld` by default
+	MaxSessions    int    // `SessionPolicyMulti` only, 0 means unlimited
+
+	// nil disables metrics, set before `Init()`
+	Metrics mtcmetrics.Registry
+	metrics *wsMetrics
+
+	// spans of connections, messages and broadcasts, nil disables tracing
+	Tracer mtctrace.Tracer
+
+	// lifecycle webhooks, nil disables, share it with `mtcrtc.RTCCoreCtx` to get the events of both
+	Webhooks *mtcwebhook.Dispatcher
+
+	// logging, set before `Init()`, nil uses `slog.Default()`. `DebugSampler` limits high-volume debug records
+	Logger       *slog.Logger
+	DebugSampler *LogSampler
+	log          *slog.Logger
+
+	// handshake, set before `InitUpgrader()`, nil allows all origins / trusts `mtc-store` of the caller
+	OriginPolicy  *OriginPolicy
+	Authenticator Authenticator
+
+	// permessage-deflate, set before `InitUpgrader()`
+	Compression CompressionOptions
+
+	// inbound limits per connection
+	InboundLimits InboundLimits
 
 	// nbio
 	WsUpgrader        *websocket.Upgrader
 	WebsocketConnPool *ttlcache.Cache[string, *WsConnContext]
 
+	// pub-sub, set before `Init()` to share with other cores
+	Topics *Topics
+
+	// reliable delivery, nil disables `SendReliable`
+	ReliableStore ReliableStore
+	ReliableTTL   time.Duration // 24 hours by default, negative never expires
+
+	// outbound queue per connection, 256 by default so a broadcast never waits for a slow peer,
+	// negative writes from the caller goroutine
+	SendQueueSize        int
+	SendQueuePolicy      string // `SendQueuePolicyDropOldest` by default
+	BroadcastConcurrency int    // writers of `BroadcastToWebSocket` without send queues, 64 by default
+
+	// heartbeat, 0 disables
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration // 3 * HeartbeatInterval by default
+
+	// resumable sessions of the `json` subprotocol, 0 disables
+	ResumeGracePeriod time.Duration
+	ResumeBufferSize  int // 256 by default
+	ResumeSessions    *ttlcache.Cache[string, *ResumeSession]
+
+	// rpc peer of every connection (`WsConnContext.RPC`), rate limits of a connection are released on disconnect. nil disables
+	RPC *mocarpc.MocaJsonRPCCtx
+
 	// event
 	OnConnected    func(*WsConnContext) error
 	OnDisConnected func(*WsConnContext) error
 	OnMessage      func(*WsConnContext, []byte) ([]byte, error)
+	OnEnvelope     func(*WsConnContext, *Envelope) (*Envelope, error) // replaces `OnMessage` if set, decoded in the subprotocol of the connection
 
 	ConnSf singleflight.Group
+
+	// conn_type:node_id -> sessions, oldest first
+	NodeSessions map[string][]*WsConnContext
+	sessionsMu   sync.Mutex
+
+	// *websocket.Conn -> chan struct{}, closed by `InitConnCtx()`, the first frames may arrive before the session is set
+	openConns sync.Map
+
+	draining atomic.Bool
 }
 
 func (corectx *WsCoreCtx) Init() {
 	InitNbioLogger()
+	corectx.log = NewModuleLogger(corectx.Logger, "mtcws")
 	corectx.Ctx, corectx.Cancel = context.WithCancel(context.Background())
 
 	if corectx.TTL == 0 {
 		corectx.TTL = time.Hour * 24
 	}
 
+	corectx.NodeSessions = make(map[string][]*WsConnContext)
+
+	if corectx.Topics == nil {
+		corectx.Topics = NewTopics()
+	}
+
+	if corectx.Metrics != nil {
+		corectx.metrics = newWsMetrics(corectx.Metrics)
+	}
+
 	// if corectx.ConnectTimeout == 0 {
 	// 	corectx.ConnectTimeout = time.Second * 10
 	// }
@@ -53,21 +132,43 @@ func (corectx *WsCoreCtx) Init() {
 
 	// conn pool
 	corectx.WebsocketConnPool.OnEviction(func(ctx context.Context, reason ttlcache.EvictionReason, i *ttlcache.Item[string, *WsConnContext]) {
-		if connCtx := i.Value(); connCtx.Conn != nil {
+		// skip closed connections removing themselves in `Close()`
+		if connCtx := i.Value(); connCtx.Conn != nil && connCtx.Ctx.Err() == nil {
 			defer connCtx.Cancel()
+			// keep the reason set before, e.g. `shutdown`
 			if reason == ttlcache.EvictionReasonExpired {
-				connCtx.Store["disconnect_reason"] = "expired"
+				connCtx.setStoreIfEmpty("disconnect_reason", "expired")
 			} else {
-				connCtx.Store["disconnect_reason"] = "kick"
+				connCtx.setStoreIfEmpty("disconnect_reason", "kick")
 			}
 		}
 	})
 
 	go corectx.WebsocketConnPool.Start()
+
+	if corectx.ReliableStore != nil {
+		go corectx.deleteExpiredReliable()
+	}
+
+	if corectx.ResumeGracePeriod > 0 {
+		if corectx.ResumeBufferSize <= 0 {
+			corectx.ResumeBufferSize = 256
+		}
+		corectx.ResumeSessions = ttlcache.New(
+			ttlcache.WithDisableTouchOnHit[string, *ResumeSession](),
+		)
+		go corectx.ResumeSessions.Start()
+	}
 }
 
 func (corectx *WsCoreCtx) Stop() error {
 	corectx.Cancel()
+	corectx.WebsocketConnPool.Range(func(item *ttlcache.Item[string, *WsConnContext]) bool {
+		if connCtx := item.Value(); connCtx != nil {
+			connCtx.setStoreIfEmpty("disconnect_reason", "shutdown")
+		}
+		return true
+	})
 	corectx.WebsocketConnPool.DeleteAll()
 	return nil
 }
@@ -81,51 +182,121 @@ func (corectx *WsCoreCtx) InitUpgrader() {
 	corectx.WsUpgrader.KeepaliveTime = corectx.TTL + corectx.ConnectTimeout // have time to send the last message
 	corectx.WsUpgrader.HandshakeTimeout = corectx.TTL + corectx.ConnectTimeout
 	corectx.WsUpgrader.CheckOrigin = AllowAllOrigin
+	if corectx.OriginPolicy != nil {
+		corectx.WsUpgrader.CheckOrigin = corectx.OriginPolicy.Check
+	}
 	corectx.WsUpgrader.Subprotocols = Protocols
 	// corectx.WsUpgrader.BlockingModHandleRead = false
 	// corectx.WsUpgrader.BlockingModAsyncWrite = true
 
+	if corectx.InboundLimits.MaxMessageSize > corectx.WsUpgrader.MessageLengthLimit {
+		corectx.WsUpgrader.MessageLengthLimit = corectx.InboundLimits.MaxMessageSize
+	}
+
+	corectx.initCompression()
+	corectx.initHeartbeatHandlers()
+	corectx.WsUpgrader.SetCloseHandler(corectx.handleClose)
+	corectx.WsUpgrader.OnOpen(func(c *websocket.Conn) {
+		corectx.openConns.Store(c, make(chan struct{}))
+	})
+
 	corectx.WsUpgrader.OnMessage(func(c *websocket.Conn, messageType websocket.MessageType, message []byte) {
-		if corectx.OnMessage == nil {
+		wsConnContext := corectx.connSession(c)
+		if wsConnContext == nil {
 			return
 		}
-		wsConnContext, ok := c.SessionWithLock().(*WsConnContext)
 
-		if !ok || wsConnContext == nil {
+		wsConnContext.Heartbeat.Seen()
+		corectx.metrics.received(wsConnContext, len(message))
+
+		if !wsConnContext.allowInbound(message) {
 			return
 		}
 
 		if slices.Contains([]string{WSPingMessageNum, WSPingMessageStr, ""}, string(message)) {
-			// yes... return void
+			// yes... return void, unless heartbeat is enabled
+			if corectx.HeartbeatInterval > 0 && len(message) > 0 {
+				wsConnContext.writeRaw([]byte(WSPongMessageStr))
+			}
+			return
+		}
+
+		if corectx.HeartbeatInterval > 0 {
+			if frame := ParseHeartbeatFrame(message); frame != nil {
+				wsConnContext.handleHeartbeatFrame(frame)
+				return
+			}
+		}
+
+		if wsConnContext.handleReliableAck(message) || wsConnContext.handleResume(message) {
+			return
+		}
+
+		if corectx.OnEnvelope != nil {
+			corectx.handleEnvelope(wsConnContext, message)
 			return
 		}
 
+		if corectx.OnMessage == nil {
+			return
+		}
+
+		_, span := wsConnContext.startMessageSpan("", len(message))
+		defer span.End()
+
 		response, err := corectx.OnMessage(wsConnContext, message)
 
 		if err != nil {
-			slog.Error("mtcws", "error", err)
+			span.RecordError(err)
+			wsConnContext.Logger.Error("handler_failed", "error", err)
 		}
 		if len(response) > 0 {
 			// slog.Debug(response)
-			if wsConnContext.Protocol == "json" {
-				c.WriteMessage(websocket.TextMessage, response)
-			} else {
-				c.WriteMessage(websocket.BinaryMessage, response)
+			if err = wsConnContext.send(response); err != nil {
+				span.RecordError(err)
+				wsConnContext.Logger.Error("write_failed", "error", err)
 			}
 		}
 	})
 	corectx.WsUpgrader.OnClose(func(c *websocket.Conn, err error) {
+		wsConnContext := corectx.connSession(c)
+		if wsConnContext == nil {
+			if err != nil {
+				corectx.logger().Error("conn_error", "remote_addr", c.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
 		if err != nil {
-			slog.Error("mtcws", "error", err)
+			wsConnContext.Logger.Error("conn_error", "error", err)
 		}
-		wsConnContext, ok := c.SessionWithLock().(*WsConnContext)
-		if !ok || wsConnContext == nil {
-			return
+		// the close frame handler runs on the executor and may not have run yet
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			wsConnContext.keepRemoteClose(closeErr.Code, closeErr.Reason)
 		}
 		wsConnContext.Cancel()
 	})
 }
 
+// connSession the session of c, the handlers of a connection wait for its `InitConnCtx()`
+func (corectx *WsCoreCtx) connSession(c *websocket.Conn) *WsConnContext {
+	if ready, ok := corectx.openConns.Load(c); ok {
+		select {
+		case <-ready.(chan struct{}):
+		case <-corectx.Ctx.Done():
+		}
+	}
+
+	wsConnContext, _ := c.Session().(*WsConnContext)
+	return wsConnContext
+}
+
+// sessionReady release the handlers of c waiting in `connSession()`, also called if the session is never set
+func (corectx *WsCoreCtx) sessionReady(c *websocket.Conn) {
+	if ready, ok := corectx.openConns.LoadAndDelete(c); ok {
+		close(ready.(chan struct{}))
+	}
+}
+
 func AutoResponseProtocol(protocol string) string {
 	if !slices.Contains(Protocols, protocol) {
 		protocol = "json"
@@ -3,25 +3,61 @@ package mtcws
 import (
 	"context"
 	"errors"
+	"maps"
 	"net/http"
 
 	"github.com/google/uuid"
 )
 
 func (wsconn *WsCoreCtx) WebsocketServer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if wsconn.IsDraining() {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		return ErrDraining
+	}
+
+	if wsconn.OriginPolicy != nil && !wsconn.OriginPolicy.Check(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return errors.New("origin not allowed")
+	}
+
 	store, ok := ctx.Value("mtc-store").(map[string]string)
+
+	// the verified identity overrides `mtc-store`, `Anonymous` only admits requests without a credential
+	authenticated := false
+	if wsconn.Authenticator != nil {
+		authStore, err := wsconn.Authenticator.Authenticate(r)
+		switch {
+		case err == nil:
+			// `mtc-store` may be shared by other requests
+			if store = maps.Clone(store); store == nil {
+				store = make(map[string]string, len(authStore))
+			}
+			maps.Copy(store, authStore)
+			authenticated = true
+		case wsconn.Anonymous && errors.Is(err, ErrMissingToken):
+		default:
+			status := AuthErrorStatus(err)
+			http.Error(w, http.StatusText(status), status)
+			return err
+		}
+	}
+
 	var nodeID, connType string
-	if !ok && !wsconn.Anonymous {
-		return errors.New("invalid store")
-	} else if ok && !wsconn.Anonymous {
+	switch {
+	case authenticated || (ok && !wsconn.Anonymous):
 		nodeID = store["node_id"]
 		connType = store["conn_type"]
-	} else {
+	case wsconn.Anonymous:
 		nodeID = uuid.NewString()
 		connType = "anonymous"
+	default:
+		return errors.New("invalid store")
 	}
 
 	if nodeID == "" || connType == "" {
+		if wsconn.Authenticator != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
 		return errors.New("invalid node-id or conn-type")
 	}
 
@@ -33,6 +69,7 @@ func (wsconn *WsCoreCtx) WebsocketServer(ctx context.Context, w http.ResponseWri
 	if err != nil {
 		// slog.Error("upgrade:", err)
 		if c != nil {
+			wsconn.sessionReady(c)
 			return c.Close()
 		}
 		return err
@@ -0,0 +1,59 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrDraining = errors.New("server is draining")
+
+// IsDraining new upgrades are rejected with 503 after `Drain()`
+func (corectx *WsCoreCtx) IsDraining() bool {
+	return corectx.draining.Load()
+}
+
+// Drain stop accepting connections and close the existing ones evenly over `window` with `disconnect_reason = "shutdown"`,
+// `reconnectHint` (e.g. another endpoint or a delay) is appended to the close text as `shutdown;reconnect=<hint>`.
+// It returns after `OnDisConnected` of every closed connection, or `ctx.Err()` when ctx is done first,
+// connections not closed yet are left to `Stop()`
+func (corectx *WsCoreCtx) Drain(ctx context.Context, window time.Duration, reconnectHint string) error {
+	corectx.draining.Store(true)
+
+	conns := corectx.SelectConns(nil)
+	corectx.logger().Info("draining", "conns", len(conns), "window", window)
+
+	var interval time.Duration
+	if len(conns) > 1 {
+		interval = window / time.Duration(len(conns)-1)
+	}
+
+	for i, conn := range conns {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if conn.Ctx.Err() != nil {
+			continue
+		}
+		if reconnectHint != "" {
+			conn.SetStore("reconnect_hint", reconnectHint)
+		}
+		conn.CloseWithReason("shutdown")
+	}
+
+	for _, conn := range conns {
+		select {
+		case <-conn.Closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	corectx.logger().Info("drained", "conns", len(conns))
+	return nil
+}
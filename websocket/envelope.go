@@ -0,0 +1,304 @@
+package mtcws
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+)
+
+// Envelope typed message shared by the `json` and `protobuf` subprotocols, see envelope.proto.
+// In json a valid json payload is inlined as `payload`, other payloads are `payload_base64`
+type Envelope struct {
+	ID      string
+	Type    string
+	Topic   string
+	Headers map[string]string
+	Payload []byte
+}
+
+type envelopeJSON struct {
+	ID            string            `json:"id,omitempty"`
+	Type          string            `json:"type"`
+	Topic         string            `json:"topic,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	PayloadBase64 []byte            `json:"payload_base64,omitempty"`
+}
+
+var ErrInvalidEnvelope = errors.New("invalid envelope")
+
+// EncodeEnvelope in the format of the subprotocol
+func EncodeEnvelope(protocol string, envelope *Envelope) ([]byte, error) {
+	if protocol == "protobuf" {
+		return envelope.MarshalProto(), nil
+	}
+	return json.Marshal(envelope)
+}
+
+func DecodeEnvelope(protocol string, data []byte) (*Envelope, error) {
+	envelope := new(Envelope)
+	if protocol == "protobuf" {
+		return envelope, envelope.UnmarshalProto(data)
+	}
+	return envelope, json.Unmarshal(data, envelope)
+}
+
+func (envelope *Envelope) MarshalJSON() ([]byte, error) {
+	frame := &envelopeJSON{
+		ID:      envelope.ID,
+		Type:    envelope.Type,
+		Topic:   envelope.Topic,
+		Headers: envelope.Headers,
+	}
+
+	if json.Valid(envelope.Payload) {
+		frame.Payload = envelope.Payload
+	} else {
+		frame.PayloadBase64 = envelope.Payload
+	}
+
+	return json.Marshal(frame)
+}
+
+func (envelope *Envelope) UnmarshalJSON(data []byte) error {
+	frame := new(envelopeJSON)
+	if err := json.Unmarshal(data, frame); err != nil {
+		return err
+	}
+	if frame.Type == "" {
+		return ErrInvalidEnvelope
+	}
+
+	envelope.ID = frame.ID
+	envelope.Type = frame.Type
+	envelope.Topic = frame.Topic
+	envelope.Headers = frame.Headers
+	envelope.Payload = frame.PayloadBase64
+	if len(frame.Payload) > 0 {
+		envelope.Payload = frame.Payload
+	}
+
+	return nil
+}
+
+const (
+	protoWireVarint = 0
+	protoWireI64    = 1
+	protoWireLen    = 2
+	protoWireI32    = 5
+)
+
+func appendProtoLen(buf []byte, field uint64, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, field<<3|protoWireLen)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// MarshalProto proto3 encoding, empty fields are omitted and headers are sorted by key
+func (envelope *Envelope) MarshalProto() []byte {
+	buf := []byte{}
+
+	for field, value := range []string{envelope.ID, envelope.Type, envelope.Topic} {
+		if value != "" {
+			buf = appendProtoLen(buf, uint64(field+1), []byte(value))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(envelope.Headers)) {
+		entry := appendProtoLen(nil, 1, []byte(key))
+		entry = appendProtoLen(entry, 2, []byte(envelope.Headers[key]))
+		buf = appendProtoLen(buf, 4, entry)
+	}
+
+	if len(envelope.Payload) > 0 {
+		buf = appendProtoLen(buf, 5, envelope.Payload)
+	}
+
+	return buf
+}
+
+// readProtoField returns the field number, wire type, the value of length-delimited fields and the rest, unknown fields are skipped by the caller
+func readProtoField(data []byte) (uint64, int, []byte, []byte, error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, nil, nil, ErrInvalidEnvelope
+	}
+	data = data[n:]
+
+	field, wireType := tag>>3, int(tag&7)
+	switch wireType {
+	case protoWireVarint:
+		if _, n = binary.Uvarint(data); n <= 0 {
+			return 0, 0, nil, nil, ErrInvalidEnvelope
+		}
+		return field, wireType, nil, data[n:], nil
+	case protoWireI64, protoWireI32:
+		size := 8
+		if wireType == protoWireI32 {
+			size = 4
+		}
+		if len(data) < size {
+			return 0, 0, nil, nil, ErrInvalidEnvelope
+		}
+		return field, wireType, nil, data[size:], nil
+	case protoWireLen:
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return 0, 0, nil, nil, ErrInvalidEnvelope
+		}
+		data = data[n:]
+		return field, wireType, data[:length], data[length:], nil
+	default:
+		return 0, 0, nil, nil, ErrInvalidEnvelope
+	}
+}
+
+func (envelope *Envelope) UnmarshalProto(data []byte) error {
+	*envelope = Envelope{}
+
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readProtoField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		if wireType != protoWireLen {
+			continue
+		}
+
+		switch field {
+		case 1:
+			envelope.ID = string(value)
+		case 2:
+			envelope.Type = string(value)
+		case 3:
+			envelope.Topic = string(value)
+		case 4:
+			var key, headerValue string
+			for len(value) > 0 {
+				entryField, entryWireType, entryValue, entryRest, err := readProtoField(value)
+				if err != nil {
+					return err
+				}
+				value = entryRest
+
+				if entryWireType == protoWireLen && entryField == 1 {
+					key = string(entryValue)
+				} else if entryWireType == protoWireLen && entryField == 2 {
+					headerValue = string(entryValue)
+				}
+			}
+			if envelope.Headers == nil {
+				envelope.Headers = make(map[string]string)
+			}
+			envelope.Headers[key] = headerValue
+		case 5:
+			envelope.Payload = slices.Clone(value)
+		}
+	}
+
+	if envelope.Type == "" {
+		return ErrInvalidEnvelope
+	}
+
+	return nil
+}
+
+func (corectx *WsCoreCtx) handleEnvelope(wsconn *WsConnContext, message []byte) {
+	envelope, err := DecodeEnvelope(wsconn.Protocol, message)
+	if err != nil {
+		wsconn.Logger.Error("envelope_decode_failed", "error", err)
+		return
+	}
+
+	ctx, span := wsconn.startMessageSpan(envelope.Headers[TraceParentHeader], len(message))
+	defer span.End()
+	span.SetAttr("mtc.envelope_type", envelope.Type)
+
+	response, err := corectx.OnEnvelope(wsconn, envelope)
+	if err != nil {
+		span.RecordError(err)
+		wsconn.Logger.Error("handler_failed", "error", err)
+	}
+	if response == nil {
+		return
+	}
+
+	data, err := EncodeEnvelope(wsconn.Protocol, withTraceParent(ctx, response))
+	if err == nil {
+		err = wsconn.send(data)
+	}
+	if err != nil {
+		span.RecordError(err)
+		wsconn.Logger.Error("write_failed", "error", err)
+	}
+}
+
+// SendEnvelope encoded in the subprotocol of the connection
+func (wsconn *WsConnContext) SendEnvelope(envelope *Envelope) error {
+	data, err := EncodeEnvelope(wsconn.Protocol, envelope)
+	if err != nil {
+		return err
+	}
+	return wsconn.SendWebsocketMessage(data)
+}
+
+// encodeEnvelopes once per subprotocol for broadcasting
+func encodeEnvelopes(envelope *Envelope) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, len(Protocols))
+	for _, protocol := range Protocols {
+		data, err := EncodeEnvelope(protocol, envelope)
+		if err != nil {
+			return nil, err
+		}
+		encoded[protocol] = data
+	}
+	return encoded, nil
+}
+
+// BroadcastEnvelope like `BroadcastToWebSocket()`, each connection receives its own subprotocol
+func (corectx *WsCoreCtx) BroadcastEnvelope(envelope *Envelope, connTypeFilter string) (map[string]error, error) {
+	return corectx.BroadcastEnvelopeContext(context.Background(), envelope, connTypeFilter)
+}
+
+// BroadcastEnvelopeContext the broadcast span is a child of the span in ctx, and is carried by the `traceparent` header
+func (corectx *WsCoreCtx) BroadcastEnvelopeContext(ctx context.Context, envelope *Envelope, connTypeFilter string) (map[string]error, error) {
+	ctx, span := corectx.startBroadcastSpan(ctx, connTypeFilter)
+
+	encoded, err := encodeEnvelopes(withTraceParent(ctx, envelope))
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+
+	errs := corectx.broadcast(connTypeFilter, func(conn *WsConnContext) error {
+		return conn.SendWebsocketMessage(encoded[conn.Protocol])
+	})
+	EndBroadcastSpan(span, errs)
+
+	return errs, nil
+}
+
+// PublishEnvelope to the members of `envelope.Topic`, members other than websocket connections (e.g. webrtc) receive json
+func (corectx *WsCoreCtx) PublishEnvelope(envelope *Envelope) (map[string]error, error) {
+	encoded, err := encodeEnvelopes(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[string]error)
+	for _, member := range corectx.Topics.Members(envelope.Topic) {
+		if conn, ok := member.(*WsConnContext); ok {
+			errs[member.MemberKey()] = conn.SendWebsocketMessage(encoded[conn.Protocol])
+		} else {
+			errs[member.MemberKey()] = member.Send(encoded["json"])
+		}
+	}
+
+	return errs, nil
+}
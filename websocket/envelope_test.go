@@ -0,0 +1,241 @@
+package mtcws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+)
+
+func assertEnvelope(t *testing.T, got, want *Envelope) {
+	t.Helper()
+
+	if got.ID != want.ID || got.Type != want.Type || got.Topic != want.Topic {
+		t.Errorf("envelope %q %q %q, want %q %q %q", got.ID, got.Type, got.Topic, want.ID, want.Type, want.Topic)
+	}
+	// nil and empty are the same on the wire
+	if len(got.Headers) != len(want.Headers) || (len(want.Headers) > 0 && !maps.Equal(got.Headers, want.Headers)) {
+		t.Errorf("headers %v, want %v", got.Headers, want.Headers)
+	}
+	if !bytes.Equal(got.Payload, want.Payload) {
+		t.Errorf("payload of %d bytes, want %d bytes", len(got.Payload), len(want.Payload))
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte{0x00, 0xff, 'a'}, 1<<20)
+
+	for _, test := range []struct {
+		name     string
+		envelope *Envelope
+	}{
+		{name: "type_only", envelope: &Envelope{Type: "t"}},
+		{name: "all_fields", envelope: &Envelope{
+			ID:      "01J000",
+			Type:    "chat.message",
+			Topic:   "room:1",
+			Headers: map[string]string{"a": "1", "b": "", "": "empty key"},
+			Payload: []byte(`{"text":"hello"}`),
+		}},
+		{name: "binary_payload", envelope: &Envelope{Type: "t", Payload: []byte{0x00, 0x01, 0xfe, 0xff}}},
+		{name: "empty_payload", envelope: &Envelope{Type: "t", Payload: []byte{}}},
+		// lengths of more than one varint byte
+		{name: "long_strings", envelope: &Envelope{ID: strings.Repeat("i", 200), Type: strings.Repeat("t", 300), Topic: strings.Repeat("p", 70000)}},
+		{name: "large_payload", envelope: &Envelope{Type: "t", Payload: large}},
+		{name: "traceparent", envelope: &Envelope{
+			Type:    "t",
+			Headers: map[string]string{TraceParentHeader: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		}},
+	} {
+		for _, protocol := range Protocols {
+			t.Run(test.name+"/"+protocol, func(t *testing.T) {
+				data, err := EncodeEnvelope(protocol, test.envelope)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := DecodeEnvelope(protocol, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEnvelope(t, got, test.envelope)
+			})
+		}
+	}
+}
+
+func TestEnvelopeTraceParent(t *testing.T) {
+	recorder := mtctrace.NewRecorder(0)
+	ctx, span := recorder.Start(context.Background(), "broadcast")
+	defer span.End()
+
+	envelope := &Envelope{Type: "t", Headers: map[string]string{"a": "1"}}
+	traced := withTraceParent(ctx, envelope)
+	if traced.Headers[TraceParentHeader] != mtctrace.Inject(ctx) || traced.Headers["a"] != "1" {
+		t.Fatalf("headers %v", traced.Headers)
+	}
+	if _, ok := envelope.Headers[TraceParentHeader]; ok {
+		t.Error("the envelope of the caller was modified")
+	}
+
+	got := new(Envelope)
+	if err := got.UnmarshalProto(traced.MarshalProto()); err != nil {
+		t.Fatal(err)
+	}
+	if extracted := mtctrace.SpanContextFromContext(mtctrace.Extract(context.Background(), got.Headers[TraceParentHeader])); extracted != span.SpanContext() {
+		t.Errorf("extracted %+v, want %+v", extracted, span.SpanContext())
+	}
+}
+
+// golden bytes of `protoc --encode=mtcws.Envelope envelope.proto`
+func TestEnvelopeProtoGolden(t *testing.T) {
+	envelope := &Envelope{ID: "1", Type: "t", Headers: map[string]string{"k": "v"}, Payload: []byte{0xff}}
+	want := []byte{
+		0x0a, 0x01, '1', // id = 1
+		0x12, 0x01, 't', // type = 2
+		0x22, 0x06, 0x0a, 0x01, 'k', 0x12, 0x01, 'v', // headers = 4, map entry key = 1 value = 2
+		0x2a, 0x01, 0xff, // payload = 5
+	}
+	if got := envelope.MarshalProto(); !bytes.Equal(got, want) {
+		t.Errorf("MarshalProto % x, want % x", got, want)
+	}
+}
+
+// the field numbers of the hand-written codec match envelope.proto
+func TestEnvelopeProtoSchema(t *testing.T) {
+	schema, err := os.ReadFile("envelope.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declared := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^\s*(string|bytes|map<string, string>) (\w+) = (\d+);`).FindAllStringSubmatch(string(schema), -1) {
+		declared[match[2]] = match[1] + " " + match[3]
+	}
+	want := map[string]string{
+		"id":      "string 1",
+		"type":    "string 2",
+		"topic":   "string 3",
+		"headers": "map<string, string> 4",
+		"payload": "bytes 5",
+	}
+	if !maps.Equal(declared, want) {
+		t.Fatalf("envelope.proto declares %v, want %v", declared, want)
+	}
+
+	// every field of a full envelope is encoded with its declared number, in order
+	envelope := &Envelope{ID: "i", Type: "t", Topic: "p", Headers: map[string]string{"k": "v"}, Payload: []byte("x")}
+	data := envelope.MarshalProto()
+	fields := []string{}
+	for len(data) > 0 {
+		field, wireType, _, rest, err := readProtoField(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wireType != protoWireLen {
+			t.Errorf("field %d of wire type %d, want length-delimited", field, wireType)
+		}
+		fields = append(fields, strconv.FormatUint(field, 10))
+		data = rest
+	}
+	if got := strings.Join(fields, ","); got != "1,2,3,4,5" {
+		t.Errorf("encoded fields %s, want 1,2,3,4,5", got)
+	}
+}
+
+func TestEnvelopeProtoUnknownFields(t *testing.T) {
+	data := (&Envelope{Type: "t", Topic: "p"}).MarshalProto()
+	// fields of a newer schema, of every wire type
+	data = append(data, 0x30, 0x96, 0x01) // 6: varint 150
+	data = append(data, 0x39, 1, 2, 3, 4, 5, 6, 7, 8)
+	data = append(data, 0x42, 0x02, 'n', 'w')
+	data = append(data, 0x4d, 1, 2, 3, 4)
+	// a varint type, id = 1 of a known field number
+	data = append(data, 0x08, 0x01)
+
+	got := new(Envelope)
+	if err := got.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	assertEnvelope(t, got, &Envelope{Type: "t", Topic: "p"})
+}
+
+func TestEnvelopeProtoMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "missing_type", data: (&Envelope{ID: "i"}).MarshalProto()},
+		{name: "truncated_tag", data: []byte{0x80}},
+		{name: "truncated_varint", data: []byte{0x08, 0x80}},
+		{name: "truncated_i64", data: []byte{0x09, 1, 2, 3}},
+		{name: "truncated_i32", data: []byte{0x0d, 1}},
+		{name: "length_past_end", data: []byte{0x12, 0x05, 't'}},
+		{name: "length_overflow", data: []byte{0x12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 't'}},
+		{name: "varint_too_long", data: []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{name: "group_wire_type", data: []byte{0x13, 0x14}},
+		{name: "invalid_wire_type", data: []byte{0x0e}},
+		{name: "malformed_header", data: append((&Envelope{Type: "t"}).MarshalProto(), 0x22, 0x02, 0x0a, 0x05)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := new(Envelope).UnmarshalProto(test.data); !errors.Is(err, ErrInvalidEnvelope) {
+				t.Errorf("UnmarshalProto returned %v, want %v", err, ErrInvalidEnvelope)
+			}
+		})
+	}
+}
+
+// every prefix cut inside a field is an error
+func TestEnvelopeProtoTruncated(t *testing.T) {
+	data := (&Envelope{ID: "i", Type: "t", Topic: "p", Headers: map[string]string{"k": "v"}, Payload: bytes.Repeat([]byte("x"), 200)}).MarshalProto()
+
+	boundaries := map[int]bool{0: true}
+	for rest := data; len(rest) > 0; {
+		_, _, _, next, err := readProtoField(rest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest = next
+		boundaries[len(data)-len(rest)] = true
+	}
+
+	for size := range len(data) {
+		err := new(Envelope).UnmarshalProto(data[:size])
+		// prefixes ending before `type` have no type
+		if !boundaries[size] || size < 6 {
+			if !errors.Is(err, ErrInvalidEnvelope) {
+				t.Errorf("prefix of %d bytes returned %v, want %v", size, err, ErrInvalidEnvelope)
+			}
+		} else if err != nil {
+			t.Errorf("prefix of %d bytes at a field boundary returned %v", size, err)
+		}
+	}
+}
+
+func FuzzEnvelopeUnmarshalProto(f *testing.F) {
+	f.Add([]byte{})
+	f.Add((&Envelope{ID: "i", Type: "t", Topic: "p", Headers: map[string]string{"k": "v"}, Payload: []byte("x")}).MarshalProto())
+	f.Add([]byte{0x12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Add([]byte{0x22, 0x02, 0x0a, 0x05})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		envelope := new(Envelope)
+		if err := envelope.UnmarshalProto(data); err != nil {
+			return
+		}
+
+		// a decoded envelope survives re-encoding
+		got := new(Envelope)
+		if err := got.UnmarshalProto(envelope.MarshalProto()); err != nil {
+			t.Fatalf("re-decode: %v", err)
+		}
+		assertEnvelope(t, got, envelope)
+	})
+}
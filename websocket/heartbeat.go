@@ -0,0 +1,129 @@
+package mtcws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lesismal/nbio/nbhttp/websocket"
+)
+
+const (
+	HeartbeatFramePing = "mtc.ping"
+	HeartbeatFramePong = "mtc.pong"
+)
+
+// HeartbeatFrame `{"type":"mtc.ping","ts":<unix nano>}` for transports without ping control frames (webrtc data channels),
+// the peer echoes `ts` in `{"type":"mtc.pong","ts":...}`. Only inspected when the heartbeat is enabled
+type HeartbeatFrame struct {
+	Type string `json:"type"`
+	TS   int64  `json:"ts"`
+}
+
+func NewHeartbeatFrame(frameType string, ts int64) []byte {
+	frame, _ := json.Marshal(&HeartbeatFrame{Type: frameType, TS: ts})
+	return frame
+}
+
+// ParseHeartbeatFrame returns nil if the message is not a heartbeat frame
+func ParseHeartbeatFrame(message []byte) *HeartbeatFrame {
+	if len(message) > 64 || !bytes.Contains(message, []byte(`"ts"`)) {
+		return nil
+	}
+
+	frame := new(HeartbeatFrame)
+	if err := json.Unmarshal(message, frame); err != nil || (frame.Type != HeartbeatFramePing && frame.Type != HeartbeatFramePong) {
+		return nil
+	}
+	return frame
+}
+
+type HeartbeatStats struct {
+	lastSeen atomic.Int64
+	rtt      atomic.Int64
+}
+
+// Seen any inbound message
+func (stats *HeartbeatStats) Seen() {
+	stats.lastSeen.Store(time.Now().UnixNano())
+}
+
+// Pong `ts` is the unix nano time the ping was sent
+func (stats *HeartbeatStats) Pong(ts int64) {
+	now := time.Now().UnixNano()
+	if ts > 0 && ts <= now {
+		stats.rtt.Store(now - ts)
+	}
+	stats.lastSeen.Store(now)
+}
+
+func (stats *HeartbeatStats) LastSeen() time.Time {
+	return time.Unix(0, stats.lastSeen.Load())
+}
+
+// RTT of the last pong, 0 before the first one
+func (stats *HeartbeatStats) RTT() time.Duration {
+	return time.Duration(stats.rtt.Load())
+}
+
+// RunHeartbeat ping every interval until ctx is done, `onTimeout` is called once when nothing was received for `timeout`
+func RunHeartbeat(ctx context.Context, interval, timeout time.Duration, stats *HeartbeatStats, ping func(ts int64) error, onTimeout func()) {
+	if timeout <= 0 {
+		timeout = interval * 3
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(stats.LastSeen()) > timeout {
+				onTimeout()
+				return
+			}
+			// write errors are detected by the timeout
+			_ = ping(time.Now().UnixNano())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (wsconn *WsConnContext) runHeartbeat() {
+	RunHeartbeat(wsconn.Ctx, wsconn.Ext.HeartbeatInterval, wsconn.Ext.HeartbeatTimeout, &wsconn.Heartbeat, func(ts int64) error {
+		return wsconn.Conn.WriteMessage(websocket.PingMessage, []byte(strconv.FormatInt(ts, 10)))
+	}, func() {
+		wsconn.CloseWithReason("heartbeat_timeout")
+	})
+}
+
+// handleHeartbeatFrame for clients that can't send ping control frames
+func (wsconn *WsConnContext) handleHeartbeatFrame(frame *HeartbeatFrame) {
+	if frame.Type == HeartbeatFramePong {
+		wsconn.Heartbeat.Pong(frame.TS)
+		return
+	}
+
+	wsconn.writeRaw(NewHeartbeatFrame(HeartbeatFramePong, frame.TS))
+}
+
+func (corectx *WsCoreCtx) initHeartbeatHandlers() {
+	corectx.WsUpgrader.SetPingHandler(func(c *websocket.Conn, data string) {
+		if wsConnContext := corectx.connSession(c); wsConnContext != nil {
+			wsConnContext.Heartbeat.Seen()
+		}
+		if err := c.WriteMessage(websocket.PongMessage, []byte(data)); err != nil {
+			c.Close()
+		}
+	})
+	corectx.WsUpgrader.SetPongHandler(func(c *websocket.Conn, data string) {
+		if wsConnContext := corectx.connSession(c); wsConnContext != nil {
+			ts, _ := strconv.ParseInt(data, 10, 64)
+			wsConnContext.Heartbeat.Pong(ts)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package mtcws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves core with the node id of the `id` query parameter, `Init()` is called here
+func newTestServer(t *testing.T, core *WsCoreCtx) *httptest.Server {
+	t.Helper()
+
+	core.Init()
+	core.InitUpgrader()
+	t.Cleanup(func() { core.Stop() })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store := map[string]string{"node_id": r.URL.Query().Get("id"), "conn_type": "user"}
+		// the connection outlives the handler
+		core.WebsocketServer(context.WithValue(context.Background(), "mtc-store", store), w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestClient(t *testing.T, configure func(client *WsCoreCtxClient)) *WsCoreCtxClient {
+	t.Helper()
+
+	client := &WsCoreCtxClient{}
+	client.ConnectTimeout = time.Second * 3
+	if configure != nil {
+		configure(client)
+	}
+	client.Init()
+	client.InitUpgrader()
+	t.Cleanup(func() { client.Stop() })
+
+	return client
+}
+
+func testURL(server *httptest.Server, id string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/?id=" + id
+}
+
+func dialTest(t *testing.T, client *WsCoreCtxClient, server *httptest.Server, id string) *WsConnContext {
+	t.Helper()
+
+	conn, err := client.WebsocketClient(context.Background(), testURL(server, id), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// waitFor polls cond for up to 5 seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// waitClosed waits for `Close()` of conn and returns its `disconnect_reason`
+func waitClosed(t *testing.T, conn *WsConnContext) string {
+	t.Helper()
+
+	select {
+	case <-conn.Closed:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("connection %s was not closed", conn.ConnKey())
+	}
+	return conn.DisconnectReason()
+}
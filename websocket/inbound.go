@@ -0,0 +1,142 @@
+package mtcws
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	InboundLimitActionDrop       = "drop"       // default
+	InboundLimitActionError      = "error"      // drop and reply an `error` envelope with `headers.error` set to the reason
+	InboundLimitActionDisconnect = "disconnect" // close with `disconnect_reason = "policy_violation"` (1008)
+)
+
+const (
+	InboundLimitMessageTooLarge = "message_too_large"
+	InboundLimitRateLimited     = "rate_limited"
+)
+
+// InboundLimits per connection, 0 disables each limit
+type InboundLimits struct {
+	MaxMessageSize int     // bytes of a message, nbio rejects messages over `WsUpgrader.MessageLengthLimit` (4MB) itself
+	MessageRate    float64 // messages per second
+	MessageBurst   int
+	ByteRate       float64 // bytes per second
+	ByteBurst      int     // `ByteRate` by default
+	Action         string
+}
+
+// InboundStats counters of inbound data messages, including the heartbeat, ack and resume frames of the library
+type InboundStats struct {
+	messages  atomic.Uint64
+	bytes     atomic.Uint64
+	limited   atomic.Uint64
+	oversized atomic.Uint64
+
+	messageBucket inboundBucket
+	byteBucket    inboundBucket
+}
+
+func (stats *InboundStats) Messages() uint64 {
+	return stats.messages.Load()
+}
+
+func (stats *InboundStats) Bytes() uint64 {
+	return stats.bytes.Load()
+}
+
+// Limited messages rejected by the rate limits
+func (stats *InboundStats) Limited() uint64 {
+	return stats.limited.Load()
+}
+
+// Oversized messages rejected by `MaxMessageSize`
+func (stats *InboundStats) Oversized() uint64 {
+	return stats.oversized.Load()
+}
+
+type inboundBucket struct {
+	tokens   float64
+	lastFill time.Time
+
+	mu sync.Mutex
+}
+
+func (bucket *inboundBucket) take(cost, rate float64, burst int) bool {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(max(burst, 1))
+	if bucket.lastFill.IsZero() {
+		bucket.tokens = capacity
+	} else {
+		bucket.tokens = min(bucket.tokens+now.Sub(bucket.lastFill).Seconds()*rate, capacity)
+	}
+	bucket.lastFill = now
+
+	if bucket.tokens < cost {
+		return false
+	}
+	bucket.tokens -= cost
+	return true
+}
+
+// check returns the reason if the message exceeds the limits
+func (limits *InboundLimits) check(stats *InboundStats, size int) string {
+	stats.messages.Add(1)
+	stats.bytes.Add(uint64(size))
+
+	if limits.MaxMessageSize > 0 && size > limits.MaxMessageSize {
+		stats.oversized.Add(1)
+		return InboundLimitMessageTooLarge
+	}
+
+	if limits.MessageRate > 0 && !stats.messageBucket.take(1, limits.MessageRate, limits.MessageBurst) {
+		stats.limited.Add(1)
+		return InboundLimitRateLimited
+	}
+
+	if limits.ByteRate > 0 {
+		burst := limits.ByteBurst
+		if burst <= 0 {
+			burst = int(limits.ByteRate)
+		}
+		// a message larger than the burst never passes
+		if !stats.byteBucket.take(float64(size), limits.ByteRate, burst) {
+			stats.limited.Add(1)
+			return InboundLimitRateLimited
+		}
+	}
+
+	return ""
+}
+
+// allowInbound returns false if the message should be dropped, the action of the limits is applied
+func (wsconn *WsConnContext) allowInbound(message []byte) bool {
+	limits := &wsconn.Ext.InboundLimits
+
+	// the rest of a flood before the connection is closed
+	if limits.Action == InboundLimitActionDisconnect && wsconn.Ctx.Err() != nil {
+		return false
+	}
+
+	reason := limits.check(&wsconn.Inbound, len(message))
+	if reason == "" {
+		return true
+	}
+
+	DebugSampled(wsconn.Logger, wsconn.Ext.DebugSampler, "inbound_limited", "reason", reason, "size", len(message))
+
+	switch limits.Action {
+	case InboundLimitActionError:
+		if err := wsconn.SendEnvelope(&Envelope{Type: "error", Headers: map[string]string{"error": reason}}); err != nil {
+			wsconn.Logger.Error("write_failed", "error", err)
+		}
+	case InboundLimitActionDisconnect:
+		wsconn.CloseWithReason("policy_violation")
+	}
+
+	return false
+}
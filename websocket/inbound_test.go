@@ -0,0 +1,136 @@
+package mtcws
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInboundLimitsCheck(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		limits InboundLimits
+		sizes  []int
+		want   []string
+	}{
+		{
+			name:   "message_size",
+			limits: InboundLimits{MaxMessageSize: 4},
+			sizes:  []int{4, 5, 1},
+			want:   []string{"", InboundLimitMessageTooLarge, ""},
+		},
+		{
+			name:   "message_rate",
+			limits: InboundLimits{MessageRate: 0.001, MessageBurst: 2},
+			sizes:  []int{1, 1, 1},
+			want:   []string{"", "", InboundLimitRateLimited},
+		},
+		{
+			// the burst is `ByteRate` by default
+			name:   "byte_rate",
+			limits: InboundLimits{ByteRate: 10},
+			sizes:  []int{6, 4, 1},
+			want:   []string{"", "", InboundLimitRateLimited},
+		},
+		{
+			name:   "larger_than_byte_burst",
+			limits: InboundLimits{ByteRate: 0.001, ByteBurst: 4},
+			sizes:  []int{5, 4},
+			want:   []string{InboundLimitRateLimited, ""},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stats := &InboundStats{}
+			for i, size := range test.sizes {
+				if reason := test.limits.check(stats, size); reason != test.want[i] {
+					t.Errorf("message %d of %d bytes: %q, want %q", i, size, reason, test.want[i])
+				}
+			}
+			if messages := stats.Messages(); messages != uint64(len(test.sizes)) {
+				t.Errorf("%d messages counted, want %d", messages, len(test.sizes))
+			}
+		})
+	}
+}
+
+func TestInboundLimitActions(t *testing.T) {
+	for _, action := range []string{InboundLimitActionDrop, InboundLimitActionError, InboundLimitActionDisconnect} {
+		t.Run(action, func(t *testing.T) {
+			connected := make(chan *WsConnContext, 1)
+			received := make(chan string, 10)
+			core := &WsCoreCtx{InboundLimits: InboundLimits{MaxMessageSize: 8, Action: action}}
+			core.OnConnected = func(conn *WsConnContext) error {
+				connected <- conn
+				return nil
+			}
+			core.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+				received <- string(message)
+				return nil, nil
+			}
+			server := newTestServer(t, core)
+
+			envelopes := make(chan *Envelope, 10)
+			client := newTestClient(t, func(client *WsCoreCtxClient) {
+				client.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+					if envelope, err := DecodeEnvelope("json", message); err == nil {
+						envelopes <- envelope
+					}
+					return nil, nil
+				}
+			})
+			clientConn := dialTest(t, client, server, "u1")
+			serverConn := <-connected
+
+			for _, message := range []string{`"small"`, `"oversized"`} {
+				if err := clientConn.SendWebsocketMessage([]byte(message)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if message := <-received; message != `"small"` {
+				t.Fatalf("received %s, want the message below the limit", message)
+			}
+
+			switch action {
+			case InboundLimitActionDrop, InboundLimitActionError:
+				if action == InboundLimitActionError {
+					select {
+					case envelope := <-envelopes:
+						if envelope.Type != "error" || envelope.Headers["error"] != InboundLimitMessageTooLarge {
+							t.Errorf("envelope %+v, want an error of %s", envelope, InboundLimitMessageTooLarge)
+						}
+					case <-time.After(time.Second * 5):
+						t.Fatal("no error envelope received")
+					}
+				}
+
+				// the connection stays open
+				if err := clientConn.SendWebsocketMessage([]byte(`"next"`)); err != nil {
+					t.Fatal(err)
+				}
+				if message := <-received; message != `"next"` {
+					t.Errorf("received %s, want the message after the dropped one", message)
+				}
+				waitFor(t, "the oversized message to be counted", func() bool { return serverConn.Inbound.Oversized() == 1 })
+				if serverConn.Ctx.Err() != nil {
+					t.Errorf("connection closed with %q", serverConn.DisconnectReason())
+				}
+			case InboundLimitActionDisconnect:
+				if reason := waitClosed(t, serverConn); reason != "policy_violation" {
+					t.Errorf("disconnect_reason %q, want policy_violation", reason)
+				}
+				waitClosed(t, clientConn)
+				// the client may be closed before it reads the close frame
+				if code := clientConn.GetStore("close_code"); code != "" && code != strconv.Itoa(CloseCodePolicyViolation) {
+					t.Errorf("closed with %s, want %d", code, CloseCodePolicyViolation)
+				}
+			}
+
+			select {
+			case message := <-received:
+				t.Errorf("the oversized message %s was handled", message)
+			default:
+			}
+		})
+	}
+}
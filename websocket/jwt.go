@@ -0,0 +1,311 @@
+package mtcws
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgEdDSA = "EdDSA" // ed25519
+)
+
+// TokenExpiryKey `Store` key of the token expiry in unix seconds, the session is disconnected with
+// `disconnect_reason = "token_expired"` when it passes, plus the duration of `TokenLeewayKey` if set
+const (
+	TokenExpiryKey = "token_exp"
+	TokenLeewayKey = "token_leeway"
+)
+
+var (
+	ErrInvalidToken = &AuthError{Status: http.StatusUnauthorized, Message: "invalid token"}
+	ErrTokenExpired = &AuthError{Status: http.StatusUnauthorized, Message: "token expired"}
+	ErrInvalidAud   = &AuthError{Status: http.StatusForbidden, Message: "invalid audience"}
+)
+
+// JWTKey `Secret` for HS256, `PublicKey` for EdDSA
+type JWTKey struct {
+	ID        string // `kid`, empty matches tokens without `kid`
+	Alg       string
+	Secret    []byte
+	PublicKey ed25519.PublicKey
+}
+
+// JWTAuthenticator verifies HS256/EdDSA signed tokens from `RequestToken()`
+type JWTAuthenticator struct {
+	Audience string        // required `aud` if set
+	Leeway   time.Duration // clock skew of `exp` and `nbf`, also delays the disconnect at `exp`
+
+	// accept tokens without `exp`, their sessions are never disconnected by the token
+	AllowNoExpiry bool
+
+	NodeIDClaim     string            // `sub` by default
+	ConnTypeClaim   string            // `conn_type` by default
+	DefaultConnType string            // used if the token has no `ConnTypeClaim`
+	StoreClaims     map[string]string // claim -> `Store` key, `{"scope": "scopes"}` by default
+
+	keys map[string]*JWTKey
+	mu   sync.RWMutex
+}
+
+func NewJWTAuthenticator(audience string, keys ...*JWTKey) *JWTAuthenticator {
+	auth := &JWTAuthenticator{
+		Audience:      audience,
+		NodeIDClaim:   "sub",
+		ConnTypeClaim: "conn_type",
+		StoreClaims:   map[string]string{"scope": "scopes"},
+		keys:          make(map[string]*JWTKey),
+	}
+
+	for _, key := range keys {
+		auth.SetKey(key)
+	}
+
+	return auth
+}
+
+// SetKey add or replace the key of `key.ID`, keep the old key until its tokens expire then `DeleteKey()`
+func (auth *JWTAuthenticator) SetKey(key *JWTKey) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.keys[key.ID] = key
+}
+
+func (auth *JWTAuthenticator) DeleteKey(kid string) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	delete(auth.keys, kid)
+}
+
+func (auth *JWTAuthenticator) key(kid string) *JWTKey {
+	auth.mu.RLock()
+	defer auth.mu.RUnlock()
+
+	return auth.keys[kid]
+}
+
+func (auth *JWTAuthenticator) Authenticate(r *http.Request) (map[string]string, error) {
+	token := RequestToken(r)
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	return auth.Verify(token)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verify returns the `Store` of the token
+func (auth *JWTAuthenticator) Verify(token string) (map[string]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	header := new(jwtHeader)
+	if err := json.Unmarshal(headerBytes, header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key := auth.key(header.Kid)
+	if key == nil || key.Alg != header.Alg {
+		return nil, ErrInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch key.Alg {
+	case JWTAlgHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case JWTAlgEdDSA:
+		if len(key.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(key.PublicKey, signed, signature) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(claimsBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return auth.store(claims)
+}
+
+func (auth *JWTAuthenticator) store(claims map[string]any) (map[string]string, error) {
+	now := time.Now()
+
+	exp, hasExp := numericClaim(claims["exp"])
+	if !hasExp && !auth.AllowNoExpiry {
+		return nil, ErrInvalidToken
+	}
+	if hasExp && now.After(time.Unix(exp, 0).Add(auth.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := numericClaim(claims["nbf"]); ok && now.Add(auth.Leeway).Before(time.Unix(nbf, 0)) {
+		return nil, ErrInvalidToken
+	}
+
+	if auth.Audience != "" && !slices.Contains(stringsClaim(claims["aud"]), auth.Audience) {
+		return nil, ErrInvalidAud
+	}
+
+	store := make(map[string]string)
+	for claim, storeKey := range auth.StoreClaims {
+		if values := stringsClaim(claims[claim]); len(values) > 0 {
+			store[storeKey] = strings.Join(values, " ")
+		}
+	}
+
+	store["node_id"] = claimString(claims[auth.NodeIDClaim])
+	store["conn_type"] = claimString(claims[auth.ConnTypeClaim])
+	if store["conn_type"] == "" {
+		store["conn_type"] = auth.DefaultConnType
+	}
+	if store["node_id"] == "" || store["conn_type"] == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if hasExp {
+		store[TokenExpiryKey] = strconv.FormatInt(exp, 10)
+		if auth.Leeway > 0 {
+			store[TokenLeewayKey] = auth.Leeway.String()
+		}
+	}
+
+	return store, nil
+}
+
+func numericClaim(value any) (int64, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	if i, err := number.Int64(); err == nil {
+		return i, true
+	}
+	f, err := number.Float64()
+	return int64(f), err == nil
+}
+
+func claimString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// stringsClaim a string or an array
+func stringsClaim(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, claimString(item))
+		}
+		return values
+	default:
+		return []string{claimString(v)}
+	}
+}
+
+// TokenExpiry of `TokenExpiryKey` in `Store` with the leeway of `TokenLeewayKey`, the time the session is disconnected
+func TokenExpiry(store map[string]string) (time.Time, bool) {
+	exp, err := strconv.ParseInt(store[TokenExpiryKey], 10, 64)
+	if err != nil || exp <= 0 {
+		return time.Time{}, false
+	}
+	leeway, _ := time.ParseDuration(store[TokenLeewayKey])
+	return time.Unix(exp, 0).Add(max(leeway, 0)), true
+}
+
+// RunTokenExpiry calls `onExpired` at exp of `TokenExpiry()` unless ctx is done before
+func RunTokenExpiry(ctx context.Context, exp time.Time, onExpired func()) {
+	timer := time.NewTimer(time.Until(exp))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		onExpired()
+	case <-ctx.Done():
+	}
+}
+
+var errJWTAlg = errors.New("unsupported alg")
+
+// SignJWT HS256 or EdDSA (`privateKey` is `ed25519.PrivateKey`), for issuing tokens to clients and tests
+func SignJWT(alg, kid string, privateKey any, claims map[string]any) (string, error) {
+	headerBytes, err := json.Marshal(&jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+
+	var signature []byte
+	switch key := privateKey.(type) {
+	case []byte:
+		if alg != JWTAlgHS256 {
+			return "", errJWTAlg
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		if alg != JWTAlgEdDSA {
+			return "", errJWTAlg
+		}
+		signature = ed25519.Sign(key, []byte(signed))
+	default:
+		return "", errJWTAlg
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,165 @@
+package mtcws
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJWTVerify(t *testing.T) {
+	secret := []byte("secret")
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivateKey, _ := ed25519.GenerateKey(nil)
+
+	auth := NewJWTAuthenticator("mtc",
+		&JWTKey{ID: "", Alg: JWTAlgHS256, Secret: secret},
+		&JWTKey{ID: "ed", Alg: JWTAlgEdDSA, PublicKey: publicKey},
+	)
+	auth.Leeway = time.Minute
+
+	now := time.Now().Unix()
+	claims := func(override map[string]any) map[string]any {
+		claims := map[string]any{"sub": "u1", "conn_type": "user", "aud": "mtc", "exp": now + 3600, "scope": []string{"read", "write"}}
+		for key, value := range override {
+			if value == nil {
+				delete(claims, key)
+				continue
+			}
+			claims[key] = value
+		}
+		return claims
+	}
+	sign := func(alg, kid string, key any, claims map[string]any) string {
+		token, err := SignJWT(alg, kid, key, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// unsigned tokens with any header
+	forge := func(header string, claims string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + "."
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "hs256", token: sign(JWTAlgHS256, "", secret, claims(nil))},
+		{name: "eddsa", token: sign(JWTAlgEdDSA, "ed", privateKey, claims(nil))},
+		{name: "hs256_wrong_secret", token: sign(JWTAlgHS256, "", []byte("other"), claims(nil)), err: ErrInvalidToken},
+		{name: "eddsa_wrong_key", token: sign(JWTAlgEdDSA, "ed", otherPrivateKey, claims(nil)), err: ErrInvalidToken},
+		{name: "unknown_kid", token: sign(JWTAlgHS256, "rotated", secret, claims(nil)), err: ErrInvalidToken},
+
+		// alg confusion, the alg of the key is authoritative
+		{name: "hs256_signed_with_public_key", token: sign(JWTAlgHS256, "ed", []byte(publicKey), claims(nil)), err: ErrInvalidToken},
+		{name: "eddsa_for_hs256_key", token: sign(JWTAlgEdDSA, "", privateKey, claims(nil)), err: ErrInvalidToken},
+		{name: "alg_none", token: forge(`{"alg":"none"}`, `{"sub":"u1","conn_type":"user","aud":"mtc","exp":`+strconv.FormatInt(now+3600, 10)+`}`), err: ErrInvalidToken},
+		{name: "alg_none_eddsa_kid", token: forge(`{"alg":"none","kid":"ed"}`, `{"sub":"u1"}`), err: ErrInvalidToken},
+
+		{name: "expired", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"exp": now - 120})), err: ErrTokenExpired},
+		{name: "expired_within_leeway", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"exp": now - 30}))},
+		{name: "not_before", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"nbf": now + 120})), err: ErrInvalidToken},
+		{name: "not_before_within_leeway", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"nbf": now + 30}))},
+		{name: "missing_exp", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"exp": nil})), err: ErrInvalidToken},
+		{name: "wrong_audience", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"aud": []string{"other"}})), err: ErrInvalidAud},
+		{name: "audience_list", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"aud": []string{"other", "mtc"}}))},
+		{name: "missing_sub", token: sign(JWTAlgHS256, "", secret, claims(map[string]any{"sub": nil})), err: ErrInvalidToken},
+		{name: "malformed", token: "a.b", err: ErrInvalidToken},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := auth.Verify(test.token)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if store["node_id"] != "u1" || store["conn_type"] != "user" || store["scopes"] != "read write" {
+				t.Errorf("store %v", store)
+			}
+			if store[TokenLeewayKey] != time.Minute.String() {
+				t.Errorf("leeway %q, want %q", store[TokenLeewayKey], time.Minute)
+			}
+		})
+	}
+}
+
+func TestJWTAllowNoExpiry(t *testing.T) {
+	secret := []byte("secret")
+	auth := NewJWTAuthenticator("", &JWTKey{Alg: JWTAlgHS256, Secret: secret})
+	auth.AllowNoExpiry = true
+
+	token, _ := SignJWT(JWTAlgHS256, "", secret, map[string]any{"sub": "u1", "conn_type": "user"})
+	store, err := auth.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TokenExpiry(store); ok {
+		t.Errorf("token without `exp` expires, store %v", store)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Now().Unix()
+	for _, test := range []struct {
+		name  string
+		store map[string]string
+		want  time.Time
+		ok    bool
+	}{
+		{name: "none", store: map[string]string{}},
+		{name: "invalid", store: map[string]string{TokenExpiryKey: "soon"}},
+		{name: "exp", store: map[string]string{TokenExpiryKey: strconv.FormatInt(exp, 10)}, want: time.Unix(exp, 0), ok: true},
+		{
+			name:  "leeway",
+			store: map[string]string{TokenExpiryKey: strconv.FormatInt(exp, 10), TokenLeewayKey: "30s"},
+			want:  time.Unix(exp, 0).Add(time.Second * 30),
+			ok:    true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := TokenExpiry(test.store)
+			if ok != test.ok || !got.Equal(test.want) {
+				t.Errorf("expiry %v %v, want %v %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestRunTokenExpiry(t *testing.T) {
+	expired := make(chan struct{})
+	start := time.Now()
+	go RunTokenExpiry(context.Background(), start.Add(time.Millisecond*50), func() { close(expired) })
+
+	select {
+	case <-expired:
+		if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+			t.Errorf("expired after %v", elapsed)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("not expired")
+	}
+
+	// a closed session is never expired
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunTokenExpiry(ctx, time.Now().Add(time.Hour), func() { t.Error("expired after the session was closed") })
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("not returned after ctx is done")
+	}
+}
@@ -1,8 +1,11 @@
 package mtcws
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/lesismal/nbio/logging"
 )
@@ -30,3 +33,94 @@ func (l *slogLogger) Error(format string, args ...any) {
 func InitNbioLogger() {
 	logging.SetLogger(&slogLogger{})
 }
+
+// logger `Logger` or `slog.Default()`, with `module=mtcws`
+func (corectx *WsCoreCtx) logger() *slog.Logger {
+	if corectx.log != nil {
+		return corectx.log
+	}
+	return NewModuleLogger(corectx.Logger, "mtcws")
+}
+
+// NewModuleLogger logger with `module`, nil uses `slog.Default()`
+func NewModuleLogger(logger *slog.Logger, module string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("module", module)
+}
+
+// initLogger the logger of the connection, `conn_id`, `conn_type`, `remote_addr` and `protocol` are set on each record
+func (wsconn *WsConnContext) initLogger() {
+	remoteAddr := ""
+	if wsconn.Conn != nil {
+		remoteAddr = wsconn.Conn.RemoteAddr().String()
+	}
+
+	wsconn.Logger = wsconn.Ext.logger().With(
+		"conn_id", wsconn.ConnKey(),
+		"conn_type", wsconn.ConnType,
+		"remote_addr", remoteAddr,
+		"protocol", wsconn.Protocol,
+	)
+}
+
+// LogSampler limit records of high-volume events, the first `First` records of a key are logged in each `Interval`, then every `Thereafter`th.
+// Set on `DebugSampler` of the cores, nil logs every record
+type LogSampler struct {
+	First      int
+	Thereafter int           // 0 drops the rest of the interval
+	Interval   time.Duration // 1s by default
+
+	counters map[string]*logSamplerCounter
+	mu       sync.Mutex
+}
+
+type logSamplerCounter struct {
+	reset time.Time
+	count int
+}
+
+func NewLogSampler(first, thereafter int, interval time.Duration) *LogSampler {
+	return &LogSampler{First: first, Thereafter: thereafter, Interval: interval}
+}
+
+// Allow whether a record of the key should be logged, always true on nil
+func (sampler *LogSampler) Allow(key string) bool {
+	if sampler == nil {
+		return true
+	}
+
+	interval := sampler.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+
+	if sampler.counters == nil {
+		sampler.counters = make(map[string]*logSamplerCounter)
+	}
+
+	now := time.Now()
+	counter, ok := sampler.counters[key]
+	if !ok || now.After(counter.reset) {
+		counter = &logSamplerCounter{reset: now.Add(interval)}
+		sampler.counters[key] = counter
+	}
+	counter.count++
+
+	if counter.count <= sampler.First {
+		return true
+	}
+	return sampler.Thereafter > 0 && (counter.count-sampler.First)%sampler.Thereafter == 0
+}
+
+// DebugSampled log a high-volume debug event, skipped if debug is disabled or `sampler` drops it
+func DebugSampled(logger *slog.Logger, sampler *LogSampler, event string, args ...any) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) || !sampler.Allow(event) {
+		return
+	}
+	logger.Debug(event, args...)
+}
@@ -0,0 +1,72 @@
+package mtcws
+
+import (
+	"time"
+
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+)
+
+type wsMetrics struct {
+	connections       mtcmetrics.Gauge
+	messagesReceived  mtcmetrics.Counter
+	messagesSent      mtcmetrics.Counter
+	bytesReceived     mtcmetrics.Counter
+	bytesSent         mtcmetrics.Counter
+	broadcastFailures mtcmetrics.Counter
+	disconnects       mtcmetrics.Counter
+	lifetime          mtcmetrics.Histogram
+}
+
+func newWsMetrics(registry mtcmetrics.Registry) *wsMetrics {
+	return &wsMetrics{
+		connections:       registry.Gauge("mtc_ws_connections", "Live websocket connections.", "conn_type"),
+		messagesReceived:  registry.Counter("mtc_ws_messages_received_total", "Websocket messages received.", "conn_type"),
+		messagesSent:      registry.Counter("mtc_ws_messages_sent_total", "Websocket messages sent.", "conn_type"),
+		bytesReceived:     registry.Counter("mtc_ws_received_bytes_total", "Websocket payload bytes received.", "conn_type"),
+		bytesSent:         registry.Counter("mtc_ws_sent_bytes_total", "Websocket payload bytes sent, before compression.", "conn_type"),
+		broadcastFailures: registry.Counter("mtc_ws_broadcast_failures_total", "Failed sends of broadcasts.", "conn_type"),
+		disconnects:       registry.Counter("mtc_ws_disconnects_total", "Closed websocket connections by disconnect_reason.", "conn_type", "reason"),
+		lifetime:          registry.Histogram("mtc_ws_connection_duration_seconds", "Lifetime of closed websocket connections.", mtcmetrics.LifetimeBuckets, "conn_type"),
+	}
+}
+
+// the methods are no-op on nil, i.e. `Metrics` is not set
+
+func (m *wsMetrics) connected(wsconn *WsConnContext) {
+	if m != nil {
+		m.connections.Add(1, wsconn.ConnType)
+	}
+}
+
+func (m *wsMetrics) closed(wsconn *WsConnContext, reason string) {
+	if m == nil {
+		return
+	}
+	if reason == "" {
+		reason = "none"
+	}
+
+	m.connections.Add(-1, wsconn.ConnType)
+	m.disconnects.Add(1, wsconn.ConnType, reason)
+	m.lifetime.Observe(time.Since(wsconn.ConnectedAt).Seconds(), wsconn.ConnType)
+}
+
+func (m *wsMetrics) received(wsconn *WsConnContext, size int) {
+	if m != nil {
+		m.messagesReceived.Add(1, wsconn.ConnType)
+		m.bytesReceived.Add(float64(size), wsconn.ConnType)
+	}
+}
+
+func (m *wsMetrics) sent(wsconn *WsConnContext, size int) {
+	if m != nil {
+		m.messagesSent.Add(1, wsconn.ConnType)
+		m.bytesSent.Add(float64(size), wsconn.ConnType)
+	}
+}
+
+func (m *wsMetrics) broadcastFailed(wsconn *WsConnContext) {
+	if m != nil {
+		m.broadcastFailures.Add(1, wsconn.ConnType)
+	}
+}
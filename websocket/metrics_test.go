@@ -0,0 +1,63 @@
+package mtcws
+
+import (
+	"strings"
+	"testing"
+
+	mtcmetrics "github.com/kdnetwork/message-transfer-core/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := mtcmetrics.NewMemoryRegistry()
+	connected := make(chan *WsConnContext, 1)
+	received := make(chan struct{}, 1)
+	core := &WsCoreCtx{Metrics: registry}
+	core.OnConnected = func(conn *WsConnContext) error {
+		connected <- conn
+		return nil
+	}
+	core.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+		received <- struct{}{}
+		return nil, nil
+	}
+	server := newTestServer(t, core)
+	delivered := make(chan struct{}, 1)
+	client := newTestClient(t, func(client *WsCoreCtxClient) {
+		client.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+			delivered <- struct{}{}
+			return nil, nil
+		}
+	})
+
+	clientConn := dialTest(t, client, server, "u1")
+	serverConn := <-connected
+	if err := clientConn.SendWebsocketMessage([]byte(`"hello"`)); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	if err := serverConn.SendWebsocketMessage([]byte(`"hi"`)); err != nil {
+		t.Fatal(err)
+	}
+	<-delivered
+
+	serverConn.CloseWithReason("kick")
+	waitClosed(t, serverConn)
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`mtc_ws_connections{conn_type="user"} 0`,
+		`mtc_ws_disconnects_total{conn_type="user",reason="kick"} 1`,
+		`mtc_ws_messages_received_total{conn_type="user"} 1`,
+		`mtc_ws_received_bytes_total{conn_type="user"} 7`,
+		`mtc_ws_messages_sent_total{conn_type="user"} 1`,
+		`mtc_ws_sent_bytes_total{conn_type="user"} 4`,
+		`mtc_ws_connection_duration_seconds_count{conn_type="user"} 1`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("no %s in\n%s", line, out.String())
+		}
+	}
+}
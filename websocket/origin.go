@@ -0,0 +1,92 @@
+package mtcws
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// OriginPolicy allowlist of the `Origin` header, entries are
+//
+//	https://example.com    exact, scheme and host (with port)
+//	*.example.com          any subdomain of example.com, any scheme; `https://*.example.com` requires https
+//	regex:^https://.+\.example\.(com|net)$   matched against the whole origin
+type OriginPolicy struct {
+	AllowEmpty bool // allow requests without `Origin`, i.e. non-browser clients
+
+	exact    map[string]bool
+	wildcard []originWildcard
+	regexps  []*regexp.Regexp
+}
+
+type originWildcard struct {
+	scheme string // empty matches any scheme
+	suffix string // `.example.com`
+}
+
+func NewOriginPolicy(allowEmpty bool, origins ...string) (*OriginPolicy, error) {
+	policy := &OriginPolicy{
+		AllowEmpty: allowEmpty,
+		exact:      make(map[string]bool),
+	}
+
+	for _, origin := range origins {
+		switch {
+		case strings.HasPrefix(origin, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(origin, "regex:"))
+			if err != nil {
+				return nil, err
+			}
+			policy.regexps = append(policy.regexps, re)
+		case strings.Contains(origin, "*."):
+			scheme, host, ok := strings.Cut(origin, "://")
+			if !ok {
+				scheme, host = "", origin
+			}
+			policy.wildcard = append(policy.wildcard, originWildcard{
+				scheme: strings.ToLower(scheme),
+				suffix: strings.ToLower(strings.TrimPrefix(host, "*")),
+			})
+		default:
+			policy.exact[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+
+	return policy, nil
+}
+
+// Check for `Upgrader.CheckOrigin`, rejected upgrades get 403
+func (policy *OriginPolicy) Check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return policy.AllowEmpty
+	}
+
+	if policy.exact[strings.ToLower(origin)] {
+		return true
+	}
+
+	if len(policy.wildcard) > 0 {
+		if u, err := url.Parse(strings.ToLower(origin)); err == nil && u.Host != "" {
+			for _, wildcard := range policy.wildcard {
+				// the port is ignored unless the pattern has one
+				host := u.Hostname()
+				if strings.Contains(wildcard.suffix, ":") {
+					host = u.Host
+				}
+				if (wildcard.scheme == "" || wildcard.scheme == u.Scheme) && strings.HasSuffix(host, wildcard.suffix) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, re := range policy.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
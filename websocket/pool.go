@@ -0,0 +1,67 @@
+package mtcws
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// SendToNodes send data to all sessions of the nodes, errors are keyed by `ConnKey()`,
+// offline nodes get `ErrNodeOffline` keyed by `conn_type:node_id`
+func (corectx *WsCoreCtx) SendToNodes(connType string, nodeIDs []string, data []byte) map[string]error {
+	errs := make(map[string]error)
+	for _, nodeID := range nodeIDs {
+		nodeErrs, err := corectx.SendToNode(connType, nodeID, data)
+		if err != nil {
+			errs[connType+":"+nodeID] = err
+			continue
+		}
+		maps.Copy(errs, nodeErrs)
+	}
+
+	return errs
+}
+
+func (corectx *WsCoreCtx) IsOnline(connType, nodeID string) bool {
+	return len(corectx.Sessions(connType, nodeID)) > 0
+}
+
+// GetConn get a session of a node, nil if it is not connected
+func (corectx *WsCoreCtx) GetConn(connType, nodeID, sessionID string) *WsConnContext {
+	if item := corectx.WebsocketConnPool.Get(connType + ":" + nodeID + ":" + sessionID); item != nil {
+		return item.Value()
+	}
+	return nil
+}
+
+// ListConns list sessions ordered by `ConnectedAt`, limit <= 0 means no limit, returns the page and the total count
+func (corectx *WsCoreCtx) ListConns(offset, limit int) ([]*WsConnContext, int) {
+	conns := corectx.SelectConns(nil)
+	total := len(conns)
+
+	offset = min(max(offset, 0), total)
+	if limit <= 0 || offset+limit > total {
+		limit = total - offset
+	}
+
+	return conns[offset : offset+limit], total
+}
+
+// SelectConns sessions whose `Store` matches, nil selects all, ordered by `ConnectedAt`
+func (corectx *WsCoreCtx) SelectConns(match func(store map[string]string) bool) []*WsConnContext {
+	conns := []*WsConnContext{}
+	corectx.WebsocketConnPool.Range(func(item *ttlcache.Item[string, *WsConnContext]) bool {
+		if conn := item.Value(); conn != nil && (match == nil || conn.matchStore(match)) {
+			conns = append(conns, conn)
+		}
+		return true
+	})
+
+	slices.SortFunc(conns, func(a, b *WsConnContext) int {
+		return cmp.Or(a.ConnectedAt.Compare(b.ConnectedAt), cmp.Compare(a.ConnKey(), b.ConnKey()))
+	})
+
+	return conns
+}
@@ -0,0 +1,47 @@
+package mtcws
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendToNode(t *testing.T) {
+	connected := make(chan *WsConnContext, 1)
+	core := &WsCoreCtx{}
+	core.OnConnected = func(conn *WsConnContext) error {
+		connected <- conn
+		return nil
+	}
+	server := newTestServer(t, core)
+	client := newTestClient(t, nil)
+
+	if _, err := core.SendToNode("user", "u1", []byte(`"m1"`)); !errors.Is(err, ErrNodeOffline) {
+		t.Fatalf("offline node error %v, want %v", err, ErrNodeOffline)
+	}
+
+	dialTest(t, client, server, "u1")
+	conn := <-connected
+
+	errs, err := core.SendToNode("user", "u1", []byte(`"m1"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sendErr, ok := errs[conn.ConnKey()]; len(errs) != 1 || !ok || sendErr != nil {
+		t.Errorf("errors %v, want a nil error of %s", errs, conn.ConnKey())
+	}
+
+	errs = core.SendToNodes("user", []string{"u1", "u2"}, []byte(`"m2"`))
+	if err, ok := errs[conn.ConnKey()]; !ok || err != nil {
+		t.Errorf("online node error %v", err)
+	}
+	if err := errs["user:u2"]; !errors.Is(err, ErrNodeOffline) {
+		t.Errorf("offline node error %v, want %v", err, ErrNodeOffline)
+	}
+
+	if got := core.GetConn("user", "u1", conn.SessionID); got != conn {
+		t.Errorf("GetConn %v, want %s", got, conn.ConnKey())
+	}
+	if got := core.GetConn("user", "u1", "other"); got != nil {
+		t.Errorf("GetConn of an unknown session %s", got.ConnKey())
+	}
+}
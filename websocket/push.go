@@ -1,7 +1,9 @@
 package mtcws
 
 import (
+	"context"
 	"errors"
+	"sync"
 
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/lesismal/nbio/nbhttp/websocket"
@@ -15,25 +17,126 @@ func (wsconn *WsConnContext) SendWebsocketMessage(data []byte) error {
 	if err := wsconn.Ctx.Err(); err != nil {
 		return err
 	}
+
+	return wsconn.send(data)
+}
+
+// write stamp the data with the sequence number of a resumable session
+func (wsconn *WsConnContext) write(data []byte) error {
+	if wsconn.Resume != nil {
+		return wsconn.Resume.write(wsconn, data)
+	}
+
+	return wsconn.writeRaw(data)
+}
+
+func (wsconn *WsConnContext) writeRaw(data []byte) error {
+	messageType := websocket.BinaryMessage
 	if wsconn.Protocol == "json" {
-		return wsconn.Conn.WriteMessage(websocket.TextMessage, data)
+		messageType = websocket.TextMessage
 	}
 
-	return wsconn.Conn.WriteMessage(websocket.BinaryMessage, data)
+	if err := wsconn.writeMessage(messageType, data); err != nil {
+		return err
+	}
+
+	wsconn.Ext.metrics.sent(wsconn, len(data))
+	return nil
 }
 
+// BroadcastToWebSocket enqueues to the send queue of every connection, connections without one (negative `SendQueueSize`)
+// are written concurrently and the broadcast waits for the slowest of them
 func (corectx *WsCoreCtx) BroadcastToWebSocket(data []byte, connTypeFilter string) map[string]error {
-	errs := make(map[string]error)
+	return corectx.BroadcastToWebSocketContext(context.Background(), data, connTypeFilter)
+}
+
+// BroadcastToWebSocketContext the broadcast span is a child of the span in ctx
+func (corectx *WsCoreCtx) BroadcastToWebSocketContext(ctx context.Context, data []byte, connTypeFilter string) map[string]error {
+	_, span := corectx.startBroadcastSpan(ctx, connTypeFilter)
+
+	errs := corectx.broadcast(connTypeFilter, func(conn *WsConnContext) error {
+		return conn.SendWebsocketMessage(data)
+	})
+	EndBroadcastSpan(span, errs)
+
+	return errs
+}
+
+func (corectx *WsCoreCtx) broadcast(connTypeFilter string, send func(conn *WsConnContext) error) map[string]error {
+	conns := []*WsConnContext{}
 	corectx.WebsocketConnPool.Range(func(item *ttlcache.Item[string, *WsConnContext]) bool {
 		conn := item.Value()
 		if conn != nil {
 			if connTypeFilter != "" && conn.ConnType != connTypeFilter {
 				return true
 			}
-			errs[item.Key()] = conn.SendWebsocketMessage(data)
+			conns = append(conns, conn)
 		}
 		return true
 	})
 
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	concurrency := corectx.BroadcastConcurrency
+	if concurrency <= 0 {
+		concurrency = 64
+	}
+	sem := make(chan struct{}, concurrency)
+
+	for _, conn := range conns {
+		// enqueue never blocks
+		if conn.SendQueue != nil {
+			err := send(conn)
+			if err != nil {
+				corectx.metrics.broadcastFailed(conn)
+			}
+
+			mu.Lock()
+			errs[conn.ConnKey()] = err
+			mu.Unlock()
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			err := send(conn)
+			if err != nil {
+				corectx.metrics.broadcastFailed(conn)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			errs[conn.ConnKey()] = err
+		})
+	}
+
+	wg.Wait()
+
 	return errs
 }
+
+// ErrNodeOffline the node has no open session
+var ErrNodeOffline = errors.New("node is offline")
+
+// SendToNode send data to all sessions of a node, errors are keyed by `ConnKey()`, `ErrNodeOffline` if it has no session
+func (corectx *WsCoreCtx) SendToNode(connType, nodeID string, data []byte) (map[string]error, error) {
+	sessions := corectx.Sessions(connType, nodeID)
+	if len(sessions) == 0 {
+		return nil, ErrNodeOffline
+	}
+
+	errs := make(map[string]error, len(sessions))
+	for _, conn := range sessions {
+		errs[conn.ConnKey()] = conn.SendWebsocketMessage(data)
+	}
+
+	return errs, nil
+}
+
+// PublishToTopic send data to all members of the topic, websocket and webrtc members are both included when `Topics` is shared
+func (corectx *WsCoreCtx) PublishToTopic(topic string, data []byte) map[string]error {
+	return corectx.Topics.Publish(topic, data)
+}
@@ -0,0 +1,150 @@
+package mtcws
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// control frame types are reserved under `mtc.`, messages of the application can't collide with them
+const (
+	ReliableFrameMessage = "mtc.reliable" // server -> client
+	ReliableFrameAck     = "mtc.ack"      // client -> server
+)
+
+const DefaultReliableTTL = time.Hour * 24
+
+// ReliableFrame `{"type":"mtc.reliable","id":"...","data":...}` is sent to the client, which answers `{"type":"mtc.ack","id":"..."}`.
+// `Data` is the original payload if it is valid json, other payloads are `data_base64`
+type ReliableFrame struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	DataBase64 []byte          `json:"data_base64,omitempty"`
+}
+
+// Payload the original payload of a received frame
+func (frame *ReliableFrame) Payload() []byte {
+	if frame.DataBase64 != nil {
+		return frame.DataBase64
+	}
+	return frame.Data
+}
+
+// SendReliable queue data for all sessions of a node, the message is redelivered on every reconnect until acked or expired.
+// A full queue of the node drops its oldest message, or returns `ErrReliableQueueFull` with `ReliablePolicyReject`
+func (corectx *WsCoreCtx) SendReliable(connType, nodeID string, data []byte) (string, error) {
+	if corectx.ReliableStore == nil {
+		return "", errors.New("reliable store is nil")
+	}
+
+	now := time.Now()
+	message := &ReliableMessage{
+		ID:        uuid.NewString(),
+		Data:      data,
+		CreatedAt: now,
+	}
+	if ttl := cmp.Or(corectx.ReliableTTL, DefaultReliableTTL); ttl > 0 {
+		message.ExpiresAt = now.Add(ttl)
+	}
+
+	if err := corectx.ReliableStore.Push(connType+":"+nodeID, message); err != nil {
+		return "", err
+	}
+
+	frame, err := message.Frame()
+	if err != nil {
+		return message.ID, err
+	}
+
+	// offline or failed sessions get it on reconnect
+	errs, _ := corectx.SendToNode(connType, nodeID, frame)
+	for connKey, err := range errs {
+		if err != nil {
+			corectx.logger().Debug("reliable_send_failed", "conn_id", connKey, "message_id", message.ID, "error", err)
+		}
+	}
+
+	return message.ID, nil
+}
+
+// frameData the payload itself if it is valid json, or the raw bytes to be sent as base64
+func frameData(payload []byte) (json.RawMessage, []byte) {
+	if json.Valid(payload) {
+		return json.RawMessage(payload), nil
+	}
+	return nil, payload
+}
+
+func (message *ReliableMessage) Frame() ([]byte, error) {
+	data, dataBase64 := frameData(message.Data)
+
+	return json.Marshal(&ReliableFrame{
+		Type:       ReliableFrameMessage,
+		ID:         message.ID,
+		Data:       data,
+		DataBase64: dataBase64,
+	})
+}
+
+// Redeliver send all pending messages of the node to this session
+func (wsconn *WsConnContext) Redeliver() error {
+	if wsconn.Ext.ReliableStore == nil {
+		return nil
+	}
+
+	pending, err := wsconn.Ext.ReliableStore.Pending(wsconn.NodeKey())
+	if err != nil {
+		return err
+	}
+
+	for _, message := range pending {
+		frame, err := message.Frame()
+		if err != nil {
+			return err
+		}
+		if err = wsconn.SendWebsocketMessage(frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleReliableAck returns true if the message is an ack frame, nothing is inspected without `ReliableStore`
+func (wsconn *WsConnContext) handleReliableAck(message []byte) bool {
+	if wsconn.Ext.ReliableStore == nil || !bytes.Contains(message, []byte(`"`+ReliableFrameAck+`"`)) {
+		return false
+	}
+
+	frame := new(ReliableFrame)
+	if err := json.Unmarshal(message, frame); err != nil || frame.Type != ReliableFrameAck || frame.ID == "" {
+		return false
+	}
+
+	if err := wsconn.Ext.ReliableStore.Ack(wsconn.NodeKey(), frame.ID); err != nil {
+		wsconn.Logger.Error("reliable_ack_failed", "message_id", frame.ID, "error", err)
+	}
+
+	return true
+}
+
+func (corectx *WsCoreCtx) deleteExpiredReliable() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := corectx.ReliableStore.DeleteExpired(); err != nil {
+				corectx.logger().Error("reliable_delete_expired_failed", "error", err)
+			}
+		case <-corectx.Ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package mtcws
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ReliablePolicyDropOldest = "drop_oldest" // default, the oldest pending message is discarded
+	ReliablePolicyReject     = "reject"      // `Push` returns `ErrReliableQueueFull`
+)
+
+// DefaultReliableMaxPending messages per node of the stores if `MaxPending` is 0
+const DefaultReliableMaxPending = 1024
+
+var ErrReliableQueueFull = errors.New("reliable queue is full")
+
+type ReliableMessage struct {
+	ID        string    `json:"id"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (message *ReliableMessage) Expired(now time.Time) bool {
+	return !message.ExpiresAt.IsZero() && now.After(message.ExpiresAt)
+}
+
+// pushCapped append message to queue after dropping expired messages, then apply the limit of pending messages
+func pushCapped(queue []*ReliableMessage, message *ReliableMessage, maxPending int, policy string) ([]*ReliableMessage, error) {
+	now := time.Now()
+	queue = slices.DeleteFunc(queue, func(message *ReliableMessage) bool {
+		return message.Expired(now)
+	})
+
+	if maxPending == 0 {
+		maxPending = DefaultReliableMaxPending
+	}
+	if maxPending > 0 && len(queue) >= maxPending {
+		if policy == ReliablePolicyReject {
+			return queue, ErrReliableQueueFull
+		}
+		queue = slices.Delete(queue, 0, len(queue)-maxPending+1)
+	}
+
+	return append(queue, message), nil
+}
+
+// ReliableStore outbound queues of unacknowledged messages, keyed by `NodeKey()`
+type ReliableStore interface {
+	Push(nodeKey string, message *ReliableMessage) error
+	Ack(nodeKey, messageID string) error
+	// Pending unexpired messages, oldest first
+	Pending(nodeKey string) ([]*ReliableMessage, error)
+	DeleteExpired() error
+}
+
+type MemoryReliableStore struct {
+	MaxPending int    // per node, `DefaultReliableMaxPending` if 0, negative is unbounded
+	Policy     string // `ReliablePolicyDropOldest` by default
+
+	queues map[string][]*ReliableMessage
+
+	mu sync.Mutex
+}
+
+func NewMemoryReliableStore() *MemoryReliableStore {
+	return &MemoryReliableStore{
+		queues: make(map[string][]*ReliableMessage),
+	}
+}
+
+func (store *MemoryReliableStore) Push(nodeKey string, message *ReliableMessage) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	queue, err := pushCapped(store.queues[nodeKey], message, store.MaxPending, store.Policy)
+	store.queues[nodeKey] = queue
+	return err
+}
+
+func (store *MemoryReliableStore) Ack(nodeKey, messageID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.queues[nodeKey] = slices.DeleteFunc(store.queues[nodeKey], func(message *ReliableMessage) bool {
+		return message.ID == messageID
+	})
+	if len(store.queues[nodeKey]) == 0 {
+		delete(store.queues, nodeKey)
+	}
+	return nil
+}
+
+func (store *MemoryReliableStore) Pending(nodeKey string) ([]*ReliableMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	pending := []*ReliableMessage{}
+	for _, message := range store.queues[nodeKey] {
+		if !message.Expired(now) {
+			pending = append(pending, message)
+		}
+	}
+	return pending, nil
+}
+
+func (store *MemoryReliableStore) DeleteExpired() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	for nodeKey, queue := range store.queues {
+		queue = slices.DeleteFunc(queue, func(message *ReliableMessage) bool {
+			return message.Expired(now)
+		})
+		if len(queue) == 0 {
+			delete(store.queues, nodeKey)
+		} else {
+			store.queues[nodeKey] = queue
+		}
+	}
+	return nil
+}
+
+// FileReliableStore one json file per node in `Dir`
+type FileReliableStore struct {
+	Dir        string
+	MaxPending int    // per node, `DefaultReliableMaxPending` if 0, negative is unbounded
+	Policy     string // `ReliablePolicyDropOldest` by default
+
+	mu sync.Mutex
+}
+
+func NewFileReliableStore(dir string) (*FileReliableStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileReliableStore{Dir: dir}, nil
+}
+
+func (store *FileReliableStore) path(nodeKey string) string {
+	return filepath.Join(store.Dir, hex.EncodeToString([]byte(nodeKey))+".json")
+}
+
+func (store *FileReliableStore) read(path string) ([]*ReliableMessage, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*ReliableMessage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	queue := []*ReliableMessage{}
+	if err = json.Unmarshal(content, &queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+func (store *FileReliableStore) write(path string, queue []*ReliableMessage) error {
+	if len(queue) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	content, err := json.Marshal(queue)
+	if err != nil {
+		return err
+	}
+
+	// replace the file at once
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, content, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (store *FileReliableStore) Push(nodeKey string, message *ReliableMessage) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	path := store.path(nodeKey)
+	queue, err := store.read(path)
+	if err != nil {
+		return err
+	}
+
+	queue, err = pushCapped(queue, message, store.MaxPending, store.Policy)
+	if err != nil {
+		return err
+	}
+	return store.write(path, queue)
+}
+
+func (store *FileReliableStore) Ack(nodeKey, messageID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	path := store.path(nodeKey)
+	queue, err := store.read(path)
+	if err != nil {
+		return err
+	}
+
+	return store.write(path, slices.DeleteFunc(queue, func(message *ReliableMessage) bool {
+		return message.ID == messageID
+	}))
+}
+
+func (store *FileReliableStore) Pending(nodeKey string) ([]*ReliableMessage, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	queue, err := store.read(store.path(nodeKey))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return slices.DeleteFunc(queue, func(message *ReliableMessage) bool {
+		return message.Expired(now)
+	}), nil
+}
+
+func (store *FileReliableStore) DeleteExpired() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, path := range paths {
+		queue, err := store.read(path)
+		if err != nil {
+			return err
+		}
+
+		pending := slices.DeleteFunc(slices.Clone(queue), func(message *ReliableMessage) bool {
+			return message.Expired(now)
+		})
+		if len(pending) == len(queue) {
+			continue
+		}
+		if err = store.write(path, pending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package mtcws
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newReliableMessage(id string, ttl time.Duration) *ReliableMessage {
+	message := &ReliableMessage{ID: id, Data: []byte(`"` + id + `"`), CreatedAt: time.Now()}
+	if ttl > 0 {
+		message.ExpiresAt = message.CreatedAt.Add(ttl)
+	}
+	return message
+}
+
+func pendingIDs(t *testing.T, store ReliableStore, nodeKey string) []string {
+	t.Helper()
+
+	pending, err := store.Pending(nodeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, message := range pending {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func assertPending(t *testing.T, store ReliableStore, nodeKey string, want ...string) {
+	t.Helper()
+
+	if ids := pendingIDs(t, store, nodeKey); !slices.Equal(ids, want) && !(len(ids) == 0 && len(want) == 0) {
+		t.Errorf("pending %v, want %v", ids, want)
+	}
+}
+
+// testReliableStores run test against both stores, the stores of a file test share a directory
+func testReliableStores(t *testing.T, test func(t *testing.T, newStore func(maxPending int, policy string) ReliableStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, func(maxPending int, policy string) ReliableStore {
+			store := NewMemoryReliableStore()
+			store.MaxPending, store.Policy = maxPending, policy
+			return store
+		})
+	})
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		test(t, func(maxPending int, policy string) ReliableStore {
+			store, err := NewFileReliableStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.MaxPending, store.Policy = maxPending, policy
+			return store
+		})
+	})
+}
+
+func TestReliableStoreAck(t *testing.T) {
+	testReliableStores(t, func(t *testing.T, newStore func(int, string) ReliableStore) {
+		store := newStore(0, "")
+		for _, id := range []string{"a", "b", "c"} {
+			if err := store.Push("user:u1", newReliableMessage(id, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.Push("user:u2", newReliableMessage("d", 0)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Ack("user:u1", "b"); err != nil {
+			t.Fatal(err)
+		}
+		// unknown ids and nodes are ignored
+		if err := store.Ack("user:u1", "d"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Ack("user:u3", "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		assertPending(t, store, "user:u1", "a", "c")
+		assertPending(t, store, "user:u2", "d")
+		assertPending(t, store, "user:u3")
+	})
+}
+
+func TestReliableStoreMaxPending(t *testing.T) {
+	testReliableStores(t, func(t *testing.T, newStore func(int, string) ReliableStore) {
+		for _, test := range []struct {
+			policy string
+			err    error
+			want   []string
+		}{
+			{policy: ReliablePolicyDropOldest, want: []string{"b", "c"}},
+			{policy: ReliablePolicyReject, err: ErrReliableQueueFull, want: []string{"a", "b"}},
+		} {
+			store := newStore(2, test.policy)
+			nodeKey := "user:" + test.policy
+			for _, id := range []string{"a", "b"} {
+				if err := store.Push(nodeKey, newReliableMessage(id, 0)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Push(nodeKey, newReliableMessage("c", 0)); !errors.Is(err, test.err) {
+				t.Errorf("%s: Push to a full queue returned %v, want %v", test.policy, err, test.err)
+			}
+			assertPending(t, store, nodeKey, test.want...)
+		}
+
+		// expired messages don't count
+		store := newStore(1, ReliablePolicyReject)
+		if err := store.Push("user:ttl", newReliableMessage("a", time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond * 5)
+		if err := store.Push("user:ttl", newReliableMessage("b", 0)); err != nil {
+			t.Errorf("Push after the pending message expired returned %v", err)
+		}
+		assertPending(t, store, "user:ttl", "b")
+	})
+}
+
+func TestReliableStoreExpiry(t *testing.T) {
+	testReliableStores(t, func(t *testing.T, newStore func(int, string) ReliableStore) {
+		store := newStore(0, "")
+		if err := store.Push("user:u1", newReliableMessage("short", time.Millisecond*20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Push("user:u1", newReliableMessage("long", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Push("user:u2", newReliableMessage("short", time.Millisecond*20)); err != nil {
+			t.Fatal(err)
+		}
+		assertPending(t, store, "user:u1", "short", "long")
+
+		time.Sleep(time.Millisecond * 30)
+		assertPending(t, store, "user:u1", "long")
+
+		if err := store.DeleteExpired(); err != nil {
+			t.Fatal(err)
+		}
+		assertPending(t, store, "user:u1", "long")
+		assertPending(t, store, "user:u2")
+
+		if fileStore, ok := store.(*FileReliableStore); ok {
+			if paths, _ := filepath.Glob(filepath.Join(fileStore.Dir, "*")); len(paths) != 1 {
+				t.Errorf("files %v, want the queue of user:u1 only", paths)
+			}
+		}
+	})
+}
+
+func TestFileReliableStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileReliableStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err = store.Push("user:u1", newReliableMessage(id, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restarted, err := NewFileReliableStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := restarted.Pending("user:u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != "a" || string(pending[0].Data) != `"a"` || pending[0].ExpiresAt.IsZero() {
+		t.Fatalf("pending after restart %+v", pending)
+	}
+
+	if err = restarted.Ack("user:u1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertPending(t, store, "user:u1", "b")
+}
+
+func TestSendReliableRedelivery(t *testing.T) {
+	core := &WsCoreCtx{ReliableStore: NewMemoryReliableStore()}
+	server := newTestServer(t, core)
+
+	frames := make(chan *ReliableFrame, 10)
+	client := newTestClient(t, func(client *WsCoreCtxClient) {
+		client.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+			frame := new(ReliableFrame)
+			if err := json.Unmarshal(message, frame); err == nil && frame.Type == ReliableFrameMessage {
+				frames <- frame
+			}
+			return nil, nil
+		}
+	})
+	nextFrame := func() *ReliableFrame {
+		t.Helper()
+		select {
+		case frame := <-frames:
+			return frame
+		case <-time.After(time.Second * 5):
+			t.Fatal("no reliable frame received")
+			return nil
+		}
+	}
+
+	// offline, delivered on connect
+	id, err := core.SendReliable("user", "u1", []byte(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialTest(t, client, server, "u1")
+	if frame := nextFrame(); frame.ID != id || string(frame.Payload()) != `{"n":1}` {
+		t.Fatalf("frame %+v, want %s", frame, id)
+	}
+
+	// not acked, redelivered after reconnect
+	conn.Cancel()
+	waitClosed(t, conn)
+	waitFor(t, "the server session to close", func() bool { return !core.IsOnline("user", "u1") })
+	conn = dialTest(t, client, server, "u1")
+	if frame := nextFrame(); frame.ID != id {
+		t.Fatalf("redelivered %s, want %s", frame.ID, id)
+	}
+
+	// online, binary payloads are base64
+	binaryID, err := core.SendReliable("user", "u1", []byte{0xff, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame := nextFrame(); frame.ID != binaryID || string(frame.Payload()) != "\xff\x00" {
+		t.Fatalf("frame %+v, want %s", frame, binaryID)
+	}
+
+	for _, ackID := range []string{id, binaryID} {
+		ack, _ := json.Marshal(&ReliableFrame{Type: ReliableFrameAck, ID: ackID})
+		if err = conn.SendWebsocketMessage(ack); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the acks", func() bool { return len(pendingIDs(t, core.ReliableStore, "user:u1")) == 0 })
+
+	// nothing left to redeliver
+	conn.Cancel()
+	waitClosed(t, conn)
+	waitFor(t, "the server session to close", func() bool { return !core.IsOnline("user", "u1") })
+	dialTest(t, client, server, "u1")
+	select {
+	case frame := <-frames:
+		t.Errorf("acked frame %s redelivered", frame.ID)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestSendReliableTTL(t *testing.T) {
+	for _, test := range []struct {
+		ttl     time.Duration
+		expires time.Duration // 0 never
+	}{
+		{ttl: 0, expires: DefaultReliableTTL},
+		{ttl: time.Minute, expires: time.Minute},
+		{ttl: -1},
+	} {
+		core := &WsCoreCtx{ReliableStore: NewMemoryReliableStore(), ReliableTTL: test.ttl}
+		core.Init()
+
+		if _, err := core.SendReliable("user", "u1", []byte(`1`)); err != nil {
+			t.Fatal(err)
+		}
+		pending, _ := core.ReliableStore.Pending("user:u1")
+		message := pending[0]
+		if got := message.ExpiresAt.Sub(message.CreatedAt); (test.expires == 0 && !message.ExpiresAt.IsZero()) || (test.expires > 0 && got != test.expires) {
+			t.Errorf("ReliableTTL %s expires after %s, want %s", test.ttl, got, test.expires)
+		}
+		core.Stop()
+	}
+}
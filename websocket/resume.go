@@ -0,0 +1,183 @@
+package mtcws
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+const (
+	ResumeFrameSession = "mtc.session" // server -> client, the token of the new session
+	ResumeFrameResume  = "mtc.resume"  // client -> server, the token and the last seen seq of the previous session
+	ResumeFrameResumed = "mtc.resumed" // server -> client, after the missed messages are replayed
+	ResumeFrameSeq     = "mtc.seq"     // server -> client, every outbound message
+)
+
+// ResumeFrame handshake, a reconnecting client sends `{"type":"mtc.resume","token":"<previous token>","seq":<last seen seq>}`,
+// the missed messages are replayed in the new session and followed by `{"type":"mtc.resumed","replayed":n,"complete":true}`.
+// `Complete` is false when some missed messages were already dropped from the replay buffer
+type ResumeFrame struct {
+	Type     string `json:"type"`
+	Token    string `json:"token"`
+	Seq      uint64 `json:"seq"`
+	Replayed int    `json:"replayed,omitempty"`
+	Complete bool   `json:"complete,omitempty"`
+}
+
+// SeqFrame `Data` is the original payload if it is valid json, other payloads are `data_base64`
+type SeqFrame struct {
+	Type       string          `json:"type"`
+	Seq        uint64          `json:"seq"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	DataBase64 []byte          `json:"data_base64,omitempty"`
+
+	payload []byte // replayed as is
+}
+
+// Payload the original payload of a received frame
+func (frame *SeqFrame) Payload() []byte {
+	if frame.DataBase64 != nil {
+		return frame.DataBase64
+	}
+	return frame.Data
+}
+
+type ResumeSession struct {
+	Token   string
+	NodeKey string
+	Seq     uint64
+	Buffer  []*SeqFrame // the last `ResumeBufferSize` messages
+
+	conn *WsConnContext
+	size int
+
+	mu sync.Mutex
+}
+
+func (corectx *WsCoreCtx) newResumeSession(wsconn *WsConnContext) *ResumeSession {
+	session := &ResumeSession{
+		Token:   uuid.NewString(),
+		NodeKey: wsconn.NodeKey(),
+		conn:    wsconn,
+		size:    corectx.ResumeBufferSize,
+	}
+
+	// kept until the connection is closed, then for `ResumeGracePeriod`
+	corectx.ResumeSessions.Set(session.Token, session, ttlcache.NoTTL)
+
+	frame, _ := json.Marshal(&ResumeFrame{
+		Type:  ResumeFrameSession,
+		Token: session.Token,
+	})
+	if err := wsconn.writeRaw(frame); err != nil {
+		wsconn.Logger.Error("resume_session_write_failed", "error", err)
+	}
+
+	return session
+}
+
+func (corectx *WsCoreCtx) detachResumeSession(wsconn *WsConnContext) {
+	if wsconn.Resume == nil || corectx.ResumeSessions == nil {
+		return
+	}
+
+	// the session may be resumed already
+	if corectx.ResumeSessions.Has(wsconn.Resume.Token) {
+		corectx.ResumeSessions.Set(wsconn.Resume.Token, wsconn.Resume, corectx.ResumeGracePeriod)
+	}
+}
+
+func (session *ResumeSession) write(wsconn *WsConnContext, data []byte) error {
+	payload, payloadBase64 := frameData(data)
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.Seq++
+	frame := &SeqFrame{
+		Type:       ResumeFrameSeq,
+		Seq:        session.Seq,
+		Data:       payload,
+		DataBase64: payloadBase64,
+		payload:    data,
+	}
+
+	session.Buffer = append(session.Buffer, frame)
+	if len(session.Buffer) > session.size {
+		session.Buffer = session.Buffer[len(session.Buffer)-session.size:]
+	}
+
+	frameBytes, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	return wsconn.writeRaw(frameBytes)
+}
+
+// missed frames after seq, and whether none was dropped, a seq the session never sent is never complete
+func (session *ResumeSession) missed(seq uint64) ([]*SeqFrame, bool) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	frames := []*SeqFrame{}
+	for _, frame := range session.Buffer {
+		if frame.Seq > seq {
+			frames = append(frames, frame)
+		}
+	}
+
+	complete := seq == session.Seq || (seq < session.Seq && len(session.Buffer) > 0 && session.Buffer[0].Seq <= seq+1)
+	return frames, complete
+}
+
+// handleResume returns true if the message is a resume frame, nothing is inspected without a resumable session
+func (wsconn *WsConnContext) handleResume(message []byte) bool {
+	if wsconn.Resume == nil || !bytes.Contains(message, []byte(`"`+ResumeFrameResume+`"`)) {
+		return false
+	}
+
+	frame := new(ResumeFrame)
+	if err := json.Unmarshal(message, frame); err != nil || frame.Type != ResumeFrameResume {
+		return false
+	}
+
+	response := &ResumeFrame{
+		Type:  ResumeFrameResumed,
+		Token: frame.Token,
+		Seq:   frame.Seq,
+	}
+
+	item, _ := wsconn.Ext.ResumeSessions.GetAndDelete(frame.Token)
+	if frame.Token != wsconn.Resume.Token && item != nil && item.Value().NodeKey == wsconn.NodeKey() {
+		previous := item.Value()
+
+		// a half-open previous connection
+		if previous.conn.Ctx.Err() == nil {
+			previous.conn.CloseWithReason("resumed")
+		}
+
+		frames, complete := previous.missed(frame.Seq)
+		for _, missedFrame := range frames {
+			if err := wsconn.write(missedFrame.payload); err != nil {
+				wsconn.Logger.Error("resume_replay_failed", "seq", frame.Seq, "error", err)
+				break
+			}
+			response.Replayed++
+		}
+		response.Complete = complete && response.Replayed == len(frames)
+	} else if item != nil {
+		// not the owner, put it back
+		wsconn.Ext.ResumeSessions.Set(frame.Token, item.Value(), item.TTL())
+	}
+
+	responseBytes, _ := json.Marshal(response)
+	if err := wsconn.writeRaw(responseBytes); err != nil {
+		wsconn.Logger.Error("resume_write_failed", "error", err)
+	}
+
+	return true
+}
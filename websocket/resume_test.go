@@ -0,0 +1,215 @@
+package mtcws
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resumeTestFrame any control frame of resumable sessions
+type resumeTestFrame struct {
+	ResumeFrame
+	Data json.RawMessage `json:"data"`
+}
+
+// resumeTestClient frames received by each connection of the client
+type resumeTestClient struct {
+	*WsCoreCtxClient
+	frames sync.Map // `SessionID` -> chan *resumeTestFrame
+}
+
+func newResumeTestClient(t *testing.T) *resumeTestClient {
+	client := &resumeTestClient{}
+	client.WsCoreCtxClient = newTestClient(t, func(wsClient *WsCoreCtxClient) {
+		wsClient.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+			frame := new(resumeTestFrame)
+			if err := json.Unmarshal(message, frame); err == nil {
+				client.conn(conn) <- frame
+			}
+			return nil, nil
+		}
+	})
+	return client
+}
+
+func (client *resumeTestClient) conn(conn *WsConnContext) chan *resumeTestFrame {
+	frames, _ := client.frames.LoadOrStore(conn.SessionID, make(chan *resumeTestFrame, 100))
+	return frames.(chan *resumeTestFrame)
+}
+
+// next frame of frameType received by conn, any frame if empty
+func (client *resumeTestClient) next(t *testing.T, conn *WsConnContext, frameType string) *resumeTestFrame {
+	t.Helper()
+
+	for {
+		select {
+		case frame := <-client.conn(conn):
+			if frameType == "" || frame.Type == frameType {
+				return frame
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("no %s frame received", frameType)
+			return nil
+		}
+	}
+}
+
+// resume send the resume frame, returns the replayed payloads and the resumed frame
+func (client *resumeTestClient) resume(t *testing.T, conn *WsConnContext, token string, seq uint64) ([]string, *resumeTestFrame) {
+	t.Helper()
+
+	message, _ := json.Marshal(&ResumeFrame{Type: ResumeFrameResume, Token: token, Seq: seq})
+	if err := conn.SendWebsocketMessage(message); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []string{}
+	for {
+		frame := client.next(t, conn, "")
+		switch frame.Type {
+		case ResumeFrameSeq:
+			replayed = append(replayed, string(frame.Data))
+		case ResumeFrameResumed:
+			return replayed, frame
+		}
+	}
+}
+
+func newResumeTestServer(t *testing.T, bufferSize int) (*WsCoreCtx, *resumeTestClient, func(id string) (*WsConnContext, string)) {
+	core := &WsCoreCtx{ResumeGracePeriod: time.Minute, ResumeBufferSize: bufferSize}
+	server := newTestServer(t, core)
+	client := newResumeTestClient(t)
+
+	dial := func(id string) (*WsConnContext, string) {
+		t.Helper()
+		conn := dialTest(t, client.WsCoreCtxClient, server, id)
+		return conn, client.next(t, conn, ResumeFrameSession).Token
+	}
+	return core, client, dial
+}
+
+// disconnect the client and wait for the server to keep its session
+func disconnectResumable(t *testing.T, core *WsCoreCtx, conn *WsConnContext, id string) {
+	t.Helper()
+
+	conn.Cancel()
+	waitClosed(t, conn)
+	waitFor(t, "the server session to close", func() bool { return !core.IsOnline("user", id) })
+}
+
+func TestResumeReplay(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		sent         int
+		seq          uint64
+		wantReplayed []string
+		wantComplete bool
+	}{
+		{name: "up_to_date", sent: 2, seq: 2, wantReplayed: []string{}, wantComplete: true},
+		{name: "nothing_sent", sent: 0, seq: 0, wantReplayed: []string{}, wantComplete: true},
+		{name: "stale_seq", sent: 3, seq: 1, wantReplayed: []string{`"m2"`, `"m3"`}, wantComplete: true},
+		{name: "from_start", sent: 3, seq: 0, wantReplayed: []string{`"m1"`, `"m2"`, `"m3"`}, wantComplete: true},
+		// the buffer keeps m3 to m5, m2 was dropped
+		{name: "past_the_buffer", sent: 5, seq: 1, wantReplayed: []string{`"m3"`, `"m4"`, `"m5"`}, wantComplete: false},
+		{name: "seq_never_sent", sent: 2, seq: 9, wantReplayed: []string{}, wantComplete: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			core, client, dial := newResumeTestServer(t, 3)
+
+			conn, token := dial("u1")
+			for i := range test.sent {
+				core.SendToNode("user", "u1", fmt.Appendf(nil, `"m%d"`, i+1))
+			}
+			for i := range test.sent {
+				if frame := client.next(t, conn, ResumeFrameSeq); frame.Seq != uint64(i+1) {
+					t.Fatalf("seq %d, want %d", frame.Seq, i+1)
+				}
+			}
+			disconnectResumable(t, core, conn, "u1")
+
+			resumed, _ := dial("u1")
+			replayed, frame := client.resume(t, resumed, token, test.seq)
+			if !slices.Equal(replayed, test.wantReplayed) {
+				t.Errorf("replayed %v, want %v", replayed, test.wantReplayed)
+			}
+			if frame.Replayed != len(test.wantReplayed) || frame.Complete != test.wantComplete || frame.Token != token || frame.Seq != test.seq {
+				t.Errorf("resumed frame %+v, want %d replayed and complete %t", frame.ResumeFrame, len(test.wantReplayed), test.wantComplete)
+			}
+		})
+	}
+}
+
+func TestResumeRejected(t *testing.T) {
+	core, client, dial := newResumeTestServer(t, 3)
+
+	conn, token := dial("u1")
+	core.SendToNode("user", "u1", []byte(`"m1"`))
+	client.next(t, conn, ResumeFrameSeq)
+
+	// its own session
+	if replayed, frame := client.resume(t, conn, token, 0); len(replayed) != 0 || frame.Complete {
+		t.Errorf("resumed its own session: %v %+v", replayed, frame.ResumeFrame)
+	}
+	disconnectResumable(t, core, conn, "u1")
+
+	// the session of another node, the token is kept for its owner
+	other, _ := dial("u2")
+	if replayed, frame := client.resume(t, other, token, 0); len(replayed) != 0 || frame.Complete {
+		t.Errorf("resumed the session of another node: %v %+v", replayed, frame.ResumeFrame)
+	}
+	if !core.ResumeSessions.Has(token) {
+		t.Fatal("the token was deleted by another node")
+	}
+
+	resumed, _ := dial("u1")
+	if replayed, frame := client.resume(t, resumed, token, 0); len(replayed) != 1 || !frame.Complete {
+		t.Fatalf("resume: %v %+v", replayed, frame.ResumeFrame)
+	}
+
+	// a token is resumed once
+	if replayed, frame := client.resume(t, resumed, token, 0); len(replayed) != 0 || frame.Complete || frame.Replayed != 0 {
+		t.Errorf("second resume on the same connection: %v %+v", replayed, frame.ResumeFrame)
+	}
+	disconnectResumable(t, core, resumed, "u1")
+	again, _ := dial("u1")
+	if replayed, frame := client.resume(t, again, token, 0); len(replayed) != 0 || frame.Complete {
+		t.Errorf("second resume on a new connection: %v %+v", replayed, frame.ResumeFrame)
+	}
+	if replayed, frame := client.resume(t, again, "unknown", 0); len(replayed) != 0 || frame.Complete {
+		t.Errorf("resume of an unknown token: %v %+v", replayed, frame.ResumeFrame)
+	}
+}
+
+// a half-open previous connection is closed when its session is resumed
+func TestResumeHalfOpen(t *testing.T) {
+	var mu sync.Mutex
+	var serverConns []*WsConnContext
+	core := &WsCoreCtx{ResumeGracePeriod: time.Minute, SessionPolicy: SessionPolicyMulti}
+	core.OnConnected = func(conn *WsConnContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		serverConns = append(serverConns, conn)
+		return nil
+	}
+	server := newTestServer(t, core)
+	client := newResumeTestClient(t)
+
+	conn := dialTest(t, client.WsCoreCtxClient, server, "u1")
+	token := client.next(t, conn, ResumeFrameSession).Token
+	resumed := dialTest(t, client.WsCoreCtxClient, server, "u1")
+	client.next(t, resumed, ResumeFrameSession)
+
+	if _, frame := client.resume(t, resumed, token, 0); !frame.Complete {
+		t.Errorf("resumed frame %+v", frame.ResumeFrame)
+	}
+
+	mu.Lock()
+	previous := serverConns[0]
+	mu.Unlock()
+	if reason := waitClosed(t, previous); reason != "resumed" {
+		t.Errorf("disconnect_reason %q, want resumed", reason)
+	}
+}
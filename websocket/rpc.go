@@ -0,0 +1,20 @@
+package mtcws
+
+import (
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+)
+
+// RPCSession the session of rpc messages from the connection, `ID` is `ConnKey()` and `Store` a copy of the store
+func (wsconn *WsConnContext) RPCSession() *mocarpc.MocaRPCSession {
+	return &mocarpc.MocaRPCSession{
+		ID:    wsconn.ConnKey(),
+		Store: wsconn.CloneStore(),
+	}
+}
+
+// closeRPC stop the peer, pending calls are canceled and the rate limit buckets of the connection are released
+func (wsconn *WsConnContext) closeRPC() {
+	if wsconn.RPC != nil {
+		wsconn.RPC.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package mtcws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kdnetwork/message-transfer-core/mocarpc"
+)
+
+func TestRPCPeerRateLimit(t *testing.T) {
+	rpc := mocarpc.InitMocaJsonRPCCtx(context.Background())
+	t.Cleanup(rpc.GlobalContextCancel)
+	rpc.RegisterMethod("whoami", func(in *mocarpc.MocaJsonRPCBase) (*mocarpc.MocaJsonRPCBase, int, error) {
+		return rpc.RsponseBuilder(in.ID, nil, in.Session.Store["node_id"]), 0, nil
+	})
+	rpc.SetRateLimit("whoami", &mocarpc.MocaRPCRateLimit{Scope: "user_id", Rate: 0.001, Burst: 1})
+
+	var mu sync.Mutex
+	var serverConn *WsConnContext
+	core := &WsCoreCtx{RPC: rpc}
+	core.OnConnected = func(conn *WsConnContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		serverConn = conn
+		return nil
+	}
+	core.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+		conn.RPC.ReadMessage(message)
+		return nil, nil
+	}
+	server := newTestServer(t, core)
+
+	responses := make(chan *mocarpc.MocaJsonRPCResponse, 10)
+	client := newTestClient(t, func(client *WsCoreCtxClient) {
+		client.OnMessage = func(conn *WsConnContext, message []byte) ([]byte, error) {
+			response := new(mocarpc.MocaJsonRPCResponse)
+			if err := json.Unmarshal(message, response); err == nil {
+				responses <- response
+			}
+			return nil, nil
+		}
+	})
+	call := func(conn *WsConnContext, id int) *mocarpc.MocaJsonRPCResponse {
+		t.Helper()
+		if err := conn.SendWebsocketMessage(fmt.Appendf(nil, `{"jsonrpc":"2.0","id":%d,"method":"whoami"}`, id)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case response := <-responses:
+			return response
+		case <-time.After(time.Second * 5):
+			t.Fatal("no rpc response")
+			return nil
+		}
+	}
+
+	// without `user_id` every connection gets its own bucket
+	for _, id := range []string{"u1", "u2"} {
+		conn := dialTest(t, client, server, id)
+		if response := call(conn, 1); response.Error != nil || string(response.Result) != `"`+id+`"` {
+			t.Fatalf("%s: first call returned %+v %+v", id, response.Result, response.Error)
+		}
+		if response := call(conn, 2); response.Error == nil || response.Error.Code != mocarpc.RateLimited {
+			t.Fatalf("%s: second call returned %+v, want rate limited", id, response.Error)
+		}
+
+		mu.Lock()
+		closed := serverConn
+		mu.Unlock()
+		if session := closed.RPC.Session; session.ID != closed.ConnKey() || session.Store["node_id"] != id {
+			t.Errorf("rpc session %+v", session)
+		}
+
+		conn.Cancel()
+		waitClosed(t, closed)
+		if buckets := rpc.RateLimitBuckets.Len(); buckets != 0 {
+			t.Errorf("%d buckets after the connection closed", buckets)
+		}
+	}
+}
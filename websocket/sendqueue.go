@@ -0,0 +1,135 @@
+package mtcws
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	SendQueuePolicyDropOldest = "drop_oldest" // default
+	SendQueuePolicyDropNewest = "drop_newest"
+	SendQueuePolicyDisconnect = "disconnect" // disconnect with `disconnect_reason = "slow_consumer"`
+)
+
+const DefaultSendQueueSize = 256
+
+var ErrSendQueueFull = errors.New("send queue is full")
+
+// SendQueue bounded outbound queue of a connection, written by its own goroutine
+type SendQueue struct {
+	Size   int
+	Policy string
+
+	items  [][]byte
+	notify chan struct{}
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	maxSeen atomic.Int64
+
+	mu sync.Mutex
+}
+
+func NewSendQueue(size int, policy string) *SendQueue {
+	return &SendQueue{
+		Size:   size,
+		Policy: policy,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Push returns `ErrSendQueueFull` if data was rejected or the connection should be disconnected
+func (queue *SendQueue) Push(data []byte) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if len(queue.items) >= queue.Size {
+		switch queue.Policy {
+		case SendQueuePolicyDropNewest, SendQueuePolicyDisconnect:
+			queue.dropped.Add(1)
+			return ErrSendQueueFull
+		default:
+			queue.items[0] = nil
+			queue.items = queue.items[1:]
+			queue.dropped.Add(1)
+		}
+	}
+
+	queue.items = append(queue.items, data)
+	if depth := int64(len(queue.items)); depth > queue.maxSeen.Load() {
+		queue.maxSeen.Store(depth)
+	}
+
+	select {
+	case queue.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (queue *SendQueue) pop() ([]byte, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if len(queue.items) == 0 {
+		return nil, false
+	}
+
+	data := queue.items[0]
+	queue.items[0] = nil
+	queue.items = queue.items[1:]
+	return data, true
+}
+
+func (queue *SendQueue) Depth() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	return len(queue.items)
+}
+
+// MaxDepth the highest depth seen
+func (queue *SendQueue) MaxDepth() int {
+	return int(queue.maxSeen.Load())
+}
+
+func (queue *SendQueue) Sent() uint64 {
+	return queue.sent.Load()
+}
+
+func (queue *SendQueue) Dropped() uint64 {
+	return queue.dropped.Load()
+}
+
+// send through the queue if enabled
+func (wsconn *WsConnContext) send(data []byte) error {
+	if wsconn.SendQueue == nil {
+		return wsconn.write(data)
+	}
+
+	err := wsconn.SendQueue.Push(data)
+	if errors.Is(err, ErrSendQueueFull) && wsconn.SendQueue.Policy == SendQueuePolicyDisconnect {
+		wsconn.CloseWithReason("slow_consumer")
+	}
+
+	return err
+}
+
+func (wsconn *WsConnContext) runSendQueue() {
+	for {
+		select {
+		case <-wsconn.SendQueue.notify:
+			for data, ok := wsconn.SendQueue.pop(); ok; data, ok = wsconn.SendQueue.pop() {
+				if err := wsconn.write(data); err != nil {
+					wsconn.Logger.Error("write_failed", "error", err)
+					continue
+				}
+				wsconn.SendQueue.sent.Add(1)
+			}
+		case <-wsconn.Ctx.Done():
+			return
+		}
+	}
+}
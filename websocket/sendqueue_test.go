@@ -0,0 +1,59 @@
+package mtcws
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSendQueuePolicies(t *testing.T) {
+	for _, test := range []struct {
+		policy string
+		err    error
+		want   []string
+	}{
+		{policy: SendQueuePolicyDropOldest, want: []string{"b", "c"}},
+		{policy: SendQueuePolicyDropNewest, err: ErrSendQueueFull, want: []string{"a", "b"}},
+		{policy: SendQueuePolicyDisconnect, err: ErrSendQueueFull, want: []string{"a", "b"}},
+	} {
+		t.Run(test.policy, func(t *testing.T) {
+			queue := NewSendQueue(2, test.policy)
+			for _, data := range []string{"a", "b"} {
+				if err := queue.Push([]byte(data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := queue.Push([]byte("c")); !errors.Is(err, test.err) {
+				t.Errorf("Push to a full queue returned %v, want %v", err, test.err)
+			}
+
+			got := []string{}
+			for data, ok := queue.pop(); ok; data, ok = queue.pop() {
+				got = append(got, string(data))
+			}
+			if len(got) != len(test.want) || got[0] != test.want[0] || got[1] != test.want[1] {
+				t.Errorf("queue %v, want %v", got, test.want)
+			}
+			if dropped, maxDepth := queue.Dropped(), queue.MaxDepth(); dropped != 1 || maxDepth != 2 {
+				t.Errorf("dropped %d max depth %d, want 1 and 2", dropped, maxDepth)
+			}
+		})
+	}
+}
+
+func TestSendQueueDisconnectsSlowConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// nobody drains the queue
+	wsconn := &WsConnContext{Ctx: ctx, Cancel: cancel, Store: map[string]string{}, SendQueue: NewSendQueue(1, SendQueuePolicyDisconnect)}
+	if err := wsconn.send([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsconn.send([]byte("b")); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("send returned %v, want %v", err, ErrSendQueueFull)
+	}
+	if ctx.Err() == nil || wsconn.DisconnectReason() != "slow_consumer" {
+		t.Errorf("disconnect_reason %q, want slow_consumer", wsconn.DisconnectReason())
+	}
+}
@@ -0,0 +1,71 @@
+package mtcws
+
+import (
+	"errors"
+	"slices"
+)
+
+const (
+	SessionPolicyKickOld   = "kick_old"   // default, a new session kicks the previous one
+	SessionPolicyRejectNew = "reject_new" // a new session is rejected while the node is online
+	SessionPolicyMulti     = "multi"      // up to `MaxSessions` sessions per node, the oldest is kicked when exceeded
+)
+
+// addSession apply `SessionPolicy`, returns whether it is the first session of the node
+func (corectx *WsCoreCtx) addSession(connCtx *WsConnContext) (bool, error) {
+	corectx.sessionsMu.Lock()
+	defer corectx.sessionsMu.Unlock()
+
+	nodeKey := connCtx.NodeKey()
+	sessions := corectx.NodeSessions[nodeKey]
+
+	var kicked []*WsConnContext
+	switch corectx.SessionPolicy {
+	case SessionPolicyRejectNew:
+		if len(sessions) > 0 {
+			return false, errors.New("node is online")
+		}
+	case SessionPolicyMulti:
+		if corectx.MaxSessions > 0 && len(sessions) >= corectx.MaxSessions {
+			kicked = sessions[:len(sessions)-corectx.MaxSessions+1]
+		}
+	default:
+		kicked = sessions
+	}
+
+	for _, existsConn := range kicked {
+		existsConn.CloseWithReason("kick")
+	}
+
+	corectx.NodeSessions[nodeKey] = append(slices.Clone(sessions[len(kicked):]), connCtx)
+
+	// a session replacing a kicked one is not the first
+	return len(sessions) == 0, nil
+}
+
+// removeSession returns whether it was the last session of the node
+func (corectx *WsCoreCtx) removeSession(connCtx *WsConnContext) bool {
+	corectx.sessionsMu.Lock()
+	defer corectx.sessionsMu.Unlock()
+
+	nodeKey := connCtx.NodeKey()
+	sessions := slices.DeleteFunc(slices.Clone(corectx.NodeSessions[nodeKey]), func(session *WsConnContext) bool {
+		return session == connCtx
+	})
+
+	if len(sessions) == 0 {
+		delete(corectx.NodeSessions, nodeKey)
+		return true
+	}
+
+	corectx.NodeSessions[nodeKey] = sessions
+	return false
+}
+
+// Sessions all sessions of a node, oldest first
+func (corectx *WsCoreCtx) Sessions(connType, nodeID string) []*WsConnContext {
+	corectx.sessionsMu.Lock()
+	defer corectx.sessionsMu.Unlock()
+
+	return slices.Clone(corectx.NodeSessions[connType+":"+nodeID])
+}
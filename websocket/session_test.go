@@ -0,0 +1,122 @@
+package mtcws
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSessionPolicies(t *testing.T) {
+	for _, test := range []struct {
+		policy      string
+		maxSessions int
+		dials       int
+		kicked      int // oldest server connections closed with `kick`
+		rejected    int // newest client connections closed with a policy violation
+	}{
+		{policy: SessionPolicyKickOld, dials: 3, kicked: 2},
+		{policy: SessionPolicyRejectNew, dials: 3, rejected: 2},
+		{policy: SessionPolicyMulti, dials: 3},
+		{policy: SessionPolicyMulti, maxSessions: 2, dials: 3, kicked: 1},
+	} {
+		t.Run(test.policy+"/"+strconv.Itoa(test.maxSessions), func(t *testing.T) {
+			var mu sync.Mutex
+			var serverConns []*WsConnContext
+			core := &WsCoreCtx{SessionPolicy: test.policy, MaxSessions: test.maxSessions}
+			core.OnConnected = func(conn *WsConnContext) error {
+				mu.Lock()
+				defer mu.Unlock()
+				serverConns = append(serverConns, conn)
+				return nil
+			}
+			server := newTestServer(t, core)
+			client := newTestClient(t, nil)
+
+			clientConns := make([]*WsConnContext, 0, test.dials)
+			for range test.dials {
+				clientConns = append(clientConns, dialTest(t, client, server, "u1"))
+			}
+
+			for _, conn := range clientConns[test.dials-test.rejected:] {
+				waitClosed(t, conn)
+				// the client may be closed before it reads the close frame
+				if code := conn.GetStore("close_code"); code != "" && code != strconv.Itoa(CloseCodePolicyViolation) {
+					t.Errorf("rejected connection closed with %q, want %d", code, CloseCodePolicyViolation)
+				}
+			}
+
+			// `OnConnected` may run after the handshake of the client
+			waitFor(t, "accepted connections", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(serverConns) >= test.dials-test.rejected
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if len(serverConns) != test.dials-test.rejected {
+				t.Fatalf("%d connections accepted, want %d", len(serverConns), test.dials-test.rejected)
+			}
+			for _, conn := range serverConns[:test.kicked] {
+				if reason := waitClosed(t, conn); reason != "kick" {
+					t.Errorf("disconnect_reason %q, want kick", reason)
+				}
+			}
+			for _, conn := range clientConns[:test.kicked] {
+				waitClosed(t, conn)
+				if code := conn.GetStore("close_code"); code != strconv.Itoa(CloseCodes["kick"]) {
+					t.Errorf("kicked connection closed with %q, want %d", code, CloseCodes["kick"])
+				}
+			}
+
+			online := serverConns[test.kicked:]
+			sessions := core.Sessions("user", "u1")
+			if len(sessions) != len(online) {
+				t.Fatalf("%d sessions, want %d", len(sessions), len(online))
+			}
+			for i, conn := range online {
+				if sessions[i] != conn || conn.Ctx.Err() != nil {
+					t.Errorf("session %d is not the open connection %s", i, conn.SessionID)
+				}
+			}
+		})
+	}
+}
+
+// concurrent dials of a node share one `addSession()`, the caller running it keeps its connection
+func TestSessionRejectNewConcurrent(t *testing.T) {
+	core := &WsCoreCtx{SessionPolicy: SessionPolicyRejectNew}
+	server := newTestServer(t, core)
+	client := newTestClient(t, nil)
+
+	const dials = 8
+	conns := make(chan *WsConnContext, dials)
+	var wg sync.WaitGroup
+	for range dials {
+		wg.Go(func() {
+			conns <- dialTest(t, client, server, "u1")
+		})
+	}
+	wg.Wait()
+	close(conns)
+
+	open := 0
+	for conn := range conns {
+		select {
+		case <-conn.Closed:
+		default:
+			// rejected connections may not have read the close frame yet
+			if conn.GetStore("close_code") == "" {
+				open++
+			}
+		}
+	}
+
+	waitFor(t, "one session", func() bool { return len(core.Sessions("user", "u1")) == 1 })
+	session := core.Sessions("user", "u1")[0]
+	if session.Ctx.Err() != nil {
+		t.Errorf("the accepted session was closed with %q", session.DisconnectReason())
+	}
+	if open == 0 {
+		t.Error("every connection was rejected")
+	}
+}
@@ -0,0 +1,63 @@
+package mtcws
+
+import (
+	"maps"
+)
+
+// `Store` is owned by the connection after `InitConnCtx()` and written by the read loop, the heartbeat and the close paths,
+// use these helpers instead of the map while the connection is served
+
+// GetStore a value of `Store`
+func (wsconn *WsConnContext) GetStore(key string) string {
+	wsconn.storeMu.RLock()
+	defer wsconn.storeMu.RUnlock()
+
+	return wsconn.Store[key]
+}
+
+// SetStore a value of `Store`
+func (wsconn *WsConnContext) SetStore(key, value string) {
+	wsconn.storeMu.Lock()
+	defer wsconn.storeMu.Unlock()
+
+	if wsconn.Store == nil {
+		wsconn.Store = make(map[string]string)
+	}
+	wsconn.Store[key] = value
+}
+
+// CloneStore a copy of `Store`
+func (wsconn *WsConnContext) CloneStore() map[string]string {
+	wsconn.storeMu.RLock()
+	defer wsconn.storeMu.RUnlock()
+
+	return maps.Clone(wsconn.Store)
+}
+
+// DisconnectReason `disconnect_reason` of the store, empty until the connection is closing
+func (wsconn *WsConnContext) DisconnectReason() string {
+	return wsconn.GetStore("disconnect_reason")
+}
+
+// setStoreIfEmpty returns false if the key has a value already, e.g. the first `disconnect_reason` wins
+func (wsconn *WsConnContext) setStoreIfEmpty(key, value string) bool {
+	wsconn.storeMu.Lock()
+	defer wsconn.storeMu.Unlock()
+
+	if wsconn.Store[key] != "" {
+		return false
+	}
+	if wsconn.Store == nil {
+		wsconn.Store = make(map[string]string)
+	}
+	wsconn.Store[key] = value
+	return true
+}
+
+// matchStore call match under the read lock
+func (wsconn *WsConnContext) matchStore(match func(store map[string]string) bool) bool {
+	wsconn.storeMu.RLock()
+	defer wsconn.storeMu.RUnlock()
+
+	return match(wsconn.Store)
+}
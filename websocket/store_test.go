@@ -0,0 +1,32 @@
+package mtcws
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCloseWithReasonFirstWins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wsconn := &WsConnContext{Ctx: ctx, Cancel: cancel, Store: map[string]string{}}
+
+	// the close paths run on different goroutines, `go test -race` reports unguarded writes
+	var wg sync.WaitGroup
+	wg.Go(func() { wsconn.CloseWithReason("kick") })
+	wg.Go(func() { wsconn.SetStore("close_code", "1000") })
+	wg.Go(func() { wsconn.setStoreIfEmpty("disconnect_reason", "remote_close") })
+	wg.Go(func() { _ = wsconn.DisconnectReason() })
+	wg.Wait()
+
+	reason := wsconn.DisconnectReason()
+	if reason != "kick" && reason != "remote_close" {
+		t.Fatalf("disconnect_reason %q", reason)
+	}
+	wsconn.CloseWithReason("shutdown")
+	if got := wsconn.DisconnectReason(); got != reason {
+		t.Errorf("disconnect_reason changed to %q after closing", got)
+	}
+	if store := wsconn.CloneStore(); store["close_code"] != "1000" {
+		t.Errorf("store %v", store)
+	}
+}
@@ -0,0 +1,114 @@
+package mtcws
+
+import (
+	"sync"
+)
+
+// TopicMember a connection that can join topics, both `WsConnContext` and `mtcrtc.RTCConnContext` are members,
+// share one `Topics` between `WsCoreCtx` and `RTCCoreCtx` to mix them in a topic
+type TopicMember interface {
+	MemberKey() string
+	Send(data []byte) error
+}
+
+type Topics struct {
+	topics  map[string]map[string]TopicMember
+	members map[string]map[string]struct{} // member key -> joined topics
+
+	mu sync.RWMutex
+}
+
+func NewTopics() *Topics {
+	return &Topics{
+		topics:  make(map[string]map[string]TopicMember),
+		members: make(map[string]map[string]struct{}),
+	}
+}
+
+func (t *Topics) Join(topic string, member TopicMember) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := member.MemberKey()
+	if t.topics[topic] == nil {
+		t.topics[topic] = make(map[string]TopicMember)
+	}
+	t.topics[topic][key] = member
+
+	if t.members[key] == nil {
+		t.members[key] = make(map[string]struct{})
+	}
+	t.members[key][topic] = struct{}{}
+}
+
+func (t *Topics) Leave(topic string, member TopicMember) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.leave(topic, member)
+}
+
+// LeaveAll remove the member from all topics, called when the connection is closed
+func (t *Topics) LeaveAll(member TopicMember) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for topic := range t.members[member.MemberKey()] {
+		t.leave(topic, member)
+	}
+}
+
+func (t *Topics) leave(topic string, member TopicMember) {
+	key := member.MemberKey()
+
+	// a reconnected member with the same key is not removed by the old connection
+	if existsMember, ok := t.topics[topic][key]; !ok || existsMember != member {
+		return
+	}
+
+	delete(t.topics[topic], key)
+	if len(t.topics[topic]) == 0 {
+		delete(t.topics, topic)
+	}
+
+	delete(t.members[key], topic)
+	if len(t.members[key]) == 0 {
+		delete(t.members, key)
+	}
+}
+
+func (t *Topics) Members(topic string) []TopicMember {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	members := make([]TopicMember, 0, len(t.topics[topic]))
+	for _, member := range t.topics[topic] {
+		members = append(members, member)
+	}
+
+	return members
+}
+
+func (t *Topics) MemberTopics(member TopicMember) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	topics := make([]string, 0, len(t.members[member.MemberKey()]))
+	for topic := range t.members[member.MemberKey()] {
+		if t.topics[topic][member.MemberKey()] == member {
+			topics = append(topics, topic)
+		}
+	}
+
+	return topics
+}
+
+// Publish send data to all members of the topic, errors are keyed by `MemberKey()`
+func (t *Topics) Publish(topic string, data []byte) map[string]error {
+	errs := make(map[string]error)
+	for _, member := range t.Members(topic) {
+		errs[member.MemberKey()] = member.Send(data)
+	}
+
+	return errs
+}
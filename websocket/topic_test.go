@@ -0,0 +1,109 @@
+package mtcws
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+type testMember struct {
+	key  string
+	sent []string
+	err  error
+}
+
+func (member *testMember) MemberKey() string {
+	return member.key
+}
+
+func (member *testMember) Send(data []byte) error {
+	member.sent = append(member.sent, string(data))
+	return member.err
+}
+
+func memberKeys(members []TopicMember) []string {
+	keys := make([]string, 0, len(members))
+	for _, member := range members {
+		keys = append(keys, member.MemberKey())
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestTopicsJoinLeave(t *testing.T) {
+	topics := NewTopics()
+	a, b := &testMember{key: "a"}, &testMember{key: "b"}
+
+	topics.Join("t1", a)
+	topics.Join("t1", b)
+	topics.Join("t2", a)
+	topics.Join("t1", a) // joined already
+
+	if keys := memberKeys(topics.Members("t1")); !slices.Equal(keys, []string{"a", "b"}) {
+		t.Errorf("members of t1 %v", keys)
+	}
+	if joined := slices.Sorted(slices.Values(topics.MemberTopics(a))); !slices.Equal(joined, []string{"t1", "t2"}) {
+		t.Errorf("topics of a %v", joined)
+	}
+
+	topics.Leave("t1", b)
+	if keys := memberKeys(topics.Members("t1")); !slices.Equal(keys, []string{"a"}) {
+		t.Errorf("members of t1 after b left %v", keys)
+	}
+	if _, ok := topics.members["b"]; ok {
+		t.Error("b is kept after leaving its only topic")
+	}
+
+	// empty topics are removed
+	topics.Leave("t2", a)
+	if _, ok := topics.topics["t2"]; ok {
+		t.Error("empty topic t2 is kept")
+	}
+
+	topics.LeaveAll(a)
+	if len(topics.topics) != 0 || len(topics.members) != 0 {
+		t.Errorf("topics %v members %v after all members left", topics.topics, topics.members)
+	}
+
+	// leaving a topic never joined is a no-op
+	topics.Leave("t3", a)
+}
+
+func TestTopicsReconnectedMember(t *testing.T) {
+	topics := NewTopics()
+	old, reconnected := &testMember{key: "a"}, &testMember{key: "a"}
+
+	topics.Join("t1", old)
+	topics.Join("t1", reconnected)
+
+	// the closed connection does not remove the new one with the same key
+	topics.LeaveAll(old)
+	if members := topics.Members("t1"); len(members) != 1 || members[0] != reconnected {
+		t.Errorf("members of t1 %v, want the reconnected member", members)
+	}
+	if joined := topics.MemberTopics(old); len(joined) != 0 {
+		t.Errorf("topics of the closed member %v", joined)
+	}
+}
+
+func TestTopicsPublish(t *testing.T) {
+	topics := NewTopics()
+	errFailed := errors.New("failed")
+	a, b, c := &testMember{key: "a"}, &testMember{key: "b", err: errFailed}, &testMember{key: "c"}
+
+	topics.Join("t1", a)
+	topics.Join("t1", b)
+	topics.Join("t2", c)
+
+	errs := topics.Publish("t1", []byte("m1"))
+	if len(errs) != 2 || errs["a"] != nil || !errors.Is(errs["b"], errFailed) {
+		t.Errorf("errors %v", errs)
+	}
+	if !slices.Equal(a.sent, []string{"m1"}) || !slices.Equal(b.sent, []string{"m1"}) || len(c.sent) != 0 {
+		t.Errorf("sent a %v b %v c %v", a.sent, b.sent, c.sent)
+	}
+
+	if errs := topics.Publish("empty", []byte("m2")); len(errs) != 0 {
+		t.Errorf("errors of an empty topic %v", errs)
+	}
+}
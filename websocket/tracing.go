@@ -0,0 +1,84 @@
+package mtcws
+
+import (
+	"context"
+	"maps"
+	"strconv"
+
+	mtctrace "github.com/kdnetwork/message-transfer-core/tracing"
+)
+
+// TraceParentHeader header of `Envelope` carrying the trace context, set on broadcasts and responses when tracing is enabled
+const TraceParentHeader = "traceparent"
+
+// ConnAttrs span attributes of a connection
+func ConnAttrs(connKey, connType, protocol string) []mtctrace.Attr {
+	return []mtctrace.Attr{
+		mtctrace.String("mtc.conn_key", connKey),
+		mtctrace.String("mtc.conn_type", connType),
+		mtctrace.String("mtc.protocol", protocol),
+	}
+}
+
+// EndBroadcastSpan count the connections and failures of a fan-out
+func EndBroadcastSpan(span mtctrace.Span, errs map[string]error) {
+	failures := 0
+	for _, err := range errs {
+		if err != nil {
+			failures++
+		}
+	}
+
+	span.SetAttr("mtc.conns", strconv.Itoa(len(errs)))
+	span.SetAttr("mtc.failures", strconv.Itoa(failures))
+	span.End()
+}
+
+// startConnSpan `mtcws.connection`, ended in `Close()`
+func (wsconn *WsConnContext) startConnSpan(ctx context.Context) {
+	_, wsconn.span = mtctrace.Start(wsconn.Ext.Tracer, ctx, "mtcws.connection", ConnAttrs(wsconn.ConnKey(), wsconn.ConnType, wsconn.Protocol)...)
+}
+
+// endConnSpan once, by `Close()` or a failed `InitConnCtx()`
+func (wsconn *WsConnContext) endConnSpan(err error) {
+	if wsconn.span == nil {
+		return
+	}
+
+	wsconn.spanOnce.Do(func() {
+		wsconn.span.RecordError(err)
+		wsconn.span.SetAttr("mtc.disconnect_reason", wsconn.DisconnectReason())
+		wsconn.span.End()
+	})
+}
+
+// startMessageSpan `mtcws.message`, a root span unless the message carries a `traceparent`
+func (wsconn *WsConnContext) startMessageSpan(traceparent string, size int) (context.Context, mtctrace.Span) {
+	ctx := mtctrace.Extract(context.Background(), traceparent)
+	attrs := append(ConnAttrs(wsconn.ConnKey(), wsconn.ConnType, wsconn.Protocol), mtctrace.String("mtc.size", strconv.Itoa(size)))
+
+	return mtctrace.Start(wsconn.Ext.Tracer, ctx, "mtcws.message", attrs...)
+}
+
+func (corectx *WsCoreCtx) startBroadcastSpan(ctx context.Context, connTypeFilter string) (context.Context, mtctrace.Span) {
+	return mtctrace.Start(corectx.Tracer, ctx, "mtcws.broadcast", mtctrace.String("mtc.conn_type_filter", connTypeFilter))
+}
+
+// withTraceParent a copy of the envelope carrying the span of ctx, unless it has a `traceparent` already
+func withTraceParent(ctx context.Context, envelope *Envelope) *Envelope {
+	if envelope == nil || envelope.Headers[TraceParentHeader] != "" {
+		return envelope
+	}
+
+	traceparent := mtctrace.Inject(ctx)
+	if traceparent == "" {
+		return envelope
+	}
+
+	traced := *envelope
+	traced.Headers = make(map[string]string, len(envelope.Headers)+1)
+	maps.Copy(traced.Headers, envelope.Headers)
+	traced.Headers[TraceParentHeader] = traceparent
+
+	return &traced
+}
@@ -4,3 +4,4 @@ var Protocols = []string{"json", "protobuf"}
 
 const WSPingMessageNum = "1"
 const WSPingMessageStr = "ping"
+const WSPongMessageStr = "pong"
@@ -0,0 +1,22 @@
+package mtcws
+
+import (
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
+)
+
+// dispatchWebhook queue a lifecycle event of the connection, the reason of disconnections is `disconnect_reason`
+func (wsconn *WsConnContext) dispatchWebhook(eventType string) {
+	if wsconn.Ext.Webhooks == nil {
+		return
+	}
+
+	event := mtcwebhook.NewEvent(eventType, "ws", wsconn.ConnKey(), wsconn.ID, wsconn.ConnType, wsconn.ConnectedAt)
+	event.SessionID = wsconn.SessionID
+	if eventType != mtcwebhook.EventConnected {
+		event.Reason = wsconn.DisconnectReason()
+	}
+
+	if err := wsconn.Ext.Webhooks.Dispatch(event); err != nil {
+		wsconn.Logger.Warn("webhook_dropped", "event", eventType, "error", err)
+	}
+}
@@ -0,0 +1,78 @@
+package mtcws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mtcwebhook "github.com/kdnetwork/message-transfer-core/webhook"
+)
+
+func TestWebhookEvents(t *testing.T) {
+	secret := []byte("secret")
+	events := make(chan *mtcwebhook.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batch, err := mtcwebhook.ReadBatch(secret, r, time.Minute)
+		if err != nil {
+			t.Errorf("read batch: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		for _, event := range batch.Events {
+			events <- event
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	dispatcher := mtcwebhook.NewDispatcher(secret, receiver.URL)
+	dispatcher.BatchInterval = time.Millisecond * 10
+	dispatcher.Start()
+	t.Cleanup(func() { dispatcher.Stop(context.Background()) })
+
+	connected := make(chan *WsConnContext, 1)
+	core := &WsCoreCtx{Webhooks: dispatcher}
+	core.OnConnected = func(conn *WsConnContext) error {
+		connected <- conn
+		return nil
+	}
+	server := newTestServer(t, core)
+	client := newTestClient(t, nil)
+
+	next := func() *mtcwebhook.Event {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second * 5):
+			t.Fatal("no webhook event received")
+			return nil
+		}
+	}
+
+	for _, test := range []struct {
+		reason string
+		event  string
+	}{
+		{reason: "kick", event: mtcwebhook.EventKicked},
+		{reason: "token_expired", event: mtcwebhook.EventExpired},
+		{reason: "heartbeat_timeout", event: mtcwebhook.EventDisconnected},
+	} {
+		dialTest(t, client, server, "u1")
+		conn := <-connected
+		if event := next(); event.Type != mtcwebhook.EventConnected || event.ConnKey != conn.ConnKey() || event.Reason != "" {
+			t.Errorf("event %+v, want connected of %s", event, conn.ConnKey())
+		}
+
+		conn.CloseWithReason(test.reason)
+		waitClosed(t, conn)
+		event := next()
+		if event.Type != test.event || event.Reason != test.reason {
+			t.Errorf("%s: event %s with reason %q, want %s", test.reason, event.Type, event.Reason, test.event)
+		}
+		if event.Transport != "ws" || event.NodeID != "u1" || event.ConnType != "user" || event.SessionID != conn.SessionID {
+			t.Errorf("%s: event %+v of another connection", test.reason, event)
+		}
+	}
+}